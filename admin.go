@@ -0,0 +1,27 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+)
+
+// adminHandler serves an operational endpoint, such as cache, retry or usage
+// statistics, only to requests with "Authorization: Bearer <token>". Without
+// a token configured the endpoint doesn't exist, so it is never public by
+// accident.
+func adminHandler(token string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if token == "" {
+			http.NotFound(w, r)
+			return
+		}
+		given, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(given), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			http.Error(w, "admin token required", http.StatusUnauthorized)
+			return
+		}
+		handler(w, r)
+	}
+}
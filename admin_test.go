@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestAdminHandler(t *testing.T) {
+	ok := func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("stats"))
+	}
+	tests := []struct {
+		token         string
+		authorization string
+		want          int
+	}{
+		{"", "", http.StatusNotFound},
+		{"", "Bearer ", http.StatusNotFound},
+		{"secret", "", http.StatusUnauthorized},
+		{"secret", "Bearer wrong", http.StatusUnauthorized},
+		{"secret", "secret", http.StatusUnauthorized},
+		{"secret", "Basic secret", http.StatusUnauthorized},
+		{"secret", "Bearer secret", http.StatusOK},
+	}
+	for _, tt := range tests {
+		req := httptest.NewRequest("GET", "/api/admin/usage", nil)
+		if tt.authorization != "" {
+			req.Header.Set("Authorization", tt.authorization)
+		}
+		recorder := httptest.NewRecorder()
+		adminHandler(tt.token, ok)(recorder, req)
+		if recorder.Code != tt.want {
+			t.Errorf("token %q, Authorization %q: status %d, want %d", tt.token, tt.authorization, recorder.Code, tt.want)
+		}
+		if recorder.Code != http.StatusOK && recorder.Body.String() == "stats" {
+			t.Errorf("token %q, Authorization %q: stats leaked", tt.token, tt.authorization)
+		}
+	}
+}
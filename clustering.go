@@ -0,0 +1,202 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+)
+
+// Limits on the number of topic clusters and k-means iterations
+const (
+	minClusters          = 2
+	maxClusters          = 10
+	maxClusterIterations = 25
+	clusterLabelTerms    = 3
+)
+
+// ResultCluster is a group of results about one topic. Terms are the words
+// that best distinguish its titles and subtitles from the other clusters.
+type ResultCluster struct {
+	Label   string         `json:"label"`
+	Terms   []string       `json:"terms"`
+	Results []SearchResult `json:"results"`
+}
+
+// stopwords are common words that make poor cluster labels and highlights
+var stopwords = map[string]bool{
+	"the": true, "and": true, "for": true, "with": true, "from": true, "that": true,
+	"this": true, "your": true, "you": true, "are": true, "how": true, "what": true,
+	"why": true, "when": true, "into": true, "about": true, "our": true, "its": true,
+	"was": true, "were": true, "has": true, "have": true, "not": true, "but": true,
+	"can": true, "all": true, "new": true, "more": true, "one": true, "will": true,
+	"using": true, "use": true, "part": true, "via": true, "than": true, "out": true,
+}
+
+// clusterResults groups results into k topics with spherical k-means over
+// their vectors. Clusters are ordered by size, and results keep their order
+// within each cluster. Results without a vector, such as lexical hits, are
+// collected into a final unlabelled cluster.
+func clusterResults(results []SearchResult, k int) []ResultCluster {
+	var vectors [][]float64
+	var members, unclustered []int
+	for i := range results {
+		if len(results[i].vector) == 0 {
+			unclustered = append(unclustered, i)
+			continue
+		}
+		vectors = append(vectors, normalizeVector(results[i].vector))
+		members = append(members, i)
+	}
+	if k > len(vectors) {
+		k = len(vectors)
+	}
+
+	var groups [][]int
+	if k > 0 {
+		assignments := kMeans(vectors, k)
+		groups = make([][]int, k)
+		for j, cluster := range assignments {
+			groups[cluster] = append(groups[cluster], members[j])
+		}
+	}
+
+	// Largest clusters first, breaking ties by their best ranked result
+	sort.SliceStable(groups, func(a, b int) bool {
+		if len(groups[a]) != len(groups[b]) {
+			return len(groups[a]) > len(groups[b])
+		}
+		return len(groups[a]) > 0 && groups[a][0] < groups[b][0]
+	})
+
+	var clusters []ResultCluster
+	labels := labelClusters(results, groups)
+	for c, group := range groups {
+		if len(group) == 0 {
+			continue
+		}
+		clusters = append(clusters, ResultCluster{
+			Label:   strings.Join(labels[c], ", "),
+			Terms:   labels[c],
+			Results: pickResults(results, group),
+		})
+	}
+	if len(unclustered) > 0 {
+		clusters = append(clusters, ResultCluster{Label: "Other", Terms: []string{}, Results: pickResults(results, unclustered)})
+	}
+	return clusters
+}
+
+// kMeans assigns each unit vector to one of k clusters by cosine similarity.
+// Centroids start from farthest-point seeding at the first vector, which is
+// the most relevant result, so the outcome is deterministic.
+func kMeans(vectors [][]float64, k int) []int {
+	centroids := [][]float64{vectors[0]}
+	nearest := make([]float64, len(vectors))
+	for i := range nearest {
+		nearest[i] = dotProduct(vectors[i], vectors[0])
+	}
+	for len(centroids) < k {
+		farthest := 0
+		for i := range vectors {
+			if nearest[i] < nearest[farthest] {
+				farthest = i
+			}
+		}
+		centroids = append(centroids, vectors[farthest])
+		for i := range vectors {
+			nearest[i] = math.Max(nearest[i], dotProduct(vectors[i], vectors[farthest]))
+		}
+	}
+
+	assignments := make([]int, len(vectors))
+	for iteration := 0; iteration < maxClusterIterations; iteration++ {
+		changed := iteration == 0
+		for i, v := range vectors {
+			best, bestSim := 0, math.Inf(-1)
+			for c, centroid := range centroids {
+				if sim := dotProduct(v, centroid); sim > bestSim {
+					best, bestSim = c, sim
+				}
+			}
+			if assignments[i] != best {
+				assignments[i] = best
+				changed = true
+			}
+		}
+		if !changed {
+			break
+		}
+
+		// Move each centroid to the normalized mean of its members
+		sums := make([][]float64, k)
+		for i, c := range assignments {
+			if sums[c] == nil {
+				sums[c] = make([]float64, len(vectors[i]))
+			}
+			for d, x := range vectors[i] {
+				sums[c][d] += x
+			}
+		}
+		for c := range centroids {
+			if sums[c] != nil {
+				centroids[c] = normalizeVector(sums[c])
+			}
+		}
+	}
+	return assignments
+}
+
+// labelClusters picks the terms of each group that are frequent in its titles
+// and subtitles but rare across the other groups
+func labelClusters(results []SearchResult, groups [][]int) [][]string {
+	counts := make([]map[string]int, len(groups))
+	groupsWithTerm := make(map[string]int)
+	for c, group := range groups {
+		counts[c] = make(map[string]int)
+		for _, i := range group {
+			for _, term := range tokenize(results[i].Title + " " + results[i].Subtitle) {
+				if len(term) < 3 || stopwords[term] || strings.Trim(term, "0123456789") == "" {
+					continue
+				}
+				counts[c][term]++
+			}
+		}
+		for term := range counts[c] {
+			groupsWithTerm[term]++
+		}
+	}
+
+	labels := make([][]string, len(groups))
+	for c := range groups {
+		type weightedTerm struct {
+			term   string
+			weight float64
+		}
+		var terms []weightedTerm
+		for term, count := range counts[c] {
+			idf := math.Log(1 + float64(len(groups))/float64(groupsWithTerm[term]))
+			terms = append(terms, weightedTerm{term, float64(count) * idf})
+		}
+		sort.Slice(terms, func(a, b int) bool {
+			if terms[a].weight != terms[b].weight {
+				return terms[a].weight > terms[b].weight
+			}
+			return terms[a].term < terms[b].term
+		})
+
+		labels[c] = []string{}
+		for t := 0; t < len(terms) && t < clusterLabelTerms; t++ {
+			labels[c] = append(labels[c], terms[t].term)
+		}
+	}
+	return labels
+}
+
+// pickResults returns the results at the given indexes
+func pickResults(results []SearchResult, indexes []int) []SearchResult {
+	picked := make([]SearchResult, len(indexes))
+	for j, i := range indexes {
+		picked[j] = results[i]
+	}
+	return picked
+}
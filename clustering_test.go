@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// clusterURLs returns the label and result URLs of each cluster
+func clusterURLs(clusters []ResultCluster) map[string][]string {
+	urls := make(map[string][]string)
+	for _, cluster := range clusters {
+		urls[cluster.Label] = resultURLs(cluster.Results)
+	}
+	return urls
+}
+
+func TestClusterResults(t *testing.T) {
+	// Two separable topics, interleaved in rank order
+	results := []SearchResult{
+		{URL: "r1", Title: "Rust borrow checker", vector: []float64{1, 0.1, 0}},
+		{URL: "b1", Title: "Sourdough bread baking", vector: []float64{0, 1, 0.1}},
+		{URL: "r2", Title: "Rust async runtime in 2024", vector: []float64{0.9, 0.2, 0}},
+		{URL: "b2", Title: "Bread baking tips", Subtitle: "Go slow", vector: []float64{0.1, 0.9, 0}},
+		{URL: "r3", Title: "Rust borrow patterns", vector: []float64{1, 0, 0.1}},
+		{URL: "lexical", Title: "Rust and bread"},
+	}
+	clusters := clusterResults(results, 2)
+
+	if len(clusters) != 3 {
+		t.Fatalf("%d clusters, want 2 topics and Other: %+v", len(clusters), clusterURLs(clusters))
+	}
+	// Largest first, keeping rank order; words under 3 letters, numbers and
+	// stopwords never label a cluster
+	want := []struct {
+		label string
+		terms []string
+		urls  []string
+	}{
+		{"rust, borrow, async", []string{"rust", "borrow", "async"}, []string{"r1", "r2", "r3"}},
+		{"baking, bread, slow", []string{"baking", "bread", "slow"}, []string{"b1", "b2"}},
+		{"Other", []string{}, []string{"lexical"}},
+	}
+	for c, w := range want {
+		got := clusters[c]
+		if got.Label != w.label || !reflect.DeepEqual(got.Terms, w.terms) || !reflect.DeepEqual(resultURLs(got.Results), w.urls) {
+			t.Errorf("cluster %d: %q %v %v, want %q %v %v", c, got.Label, got.Terms, resultURLs(got.Results), w.label, w.terms, w.urls)
+		}
+	}
+}
+
+func TestClusterResultsWithoutEnoughVectors(t *testing.T) {
+	// Without vectors there is nothing to cluster
+	results := []SearchResult{{URL: "a", Title: "Rust"}, {URL: "b", Title: "Go"}}
+	clusters := clusterResults(results, 3)
+	if len(clusters) != 1 || clusters[0].Label != "Other" || len(clusters[0].Results) != 2 {
+		t.Errorf("clusters %+v, want every result under Other", clusterURLs(clusters))
+	}
+
+	// Fewer vectors than clusters gives each its own cluster
+	results = []SearchResult{
+		{URL: "a", Title: "Rust ownership", vector: []float64{1, 0}},
+		{URL: "b", Title: "Bread baking", vector: []float64{0, 1}},
+	}
+	clusters = clusterResults(results, 5)
+	want := map[string][]string{"ownership, rust": {"a"}, "baking, bread": {"b"}}
+	if got := clusterURLs(clusters); !reflect.DeepEqual(got, want) {
+		t.Errorf("clusters %v, want %v", got, want)
+	}
+
+	if clusters := clusterResults(nil, 3); len(clusters) != 0 {
+		t.Errorf("clusters of no results: %+v", clusters)
+	}
+}
+
+func TestKMeans(t *testing.T) {
+	vectors := [][]float64{
+		normalizeVector([]float64{1, 0.1}),
+		normalizeVector([]float64{0.1, 1}),
+		normalizeVector([]float64{0.9, 0.3}),
+		normalizeVector([]float64{0.2, 1}),
+	}
+	// The first vector seeds cluster 0 and the one farthest from it cluster 1
+	if got := kMeans(vectors, 2); !reflect.DeepEqual(got, []int{0, 1, 0, 1}) {
+		t.Errorf("assignments %v", got)
+	}
+	if got := kMeans(vectors, 1); !reflect.DeepEqual(got, []int{0, 0, 0, 0}) {
+		t.Errorf("assignments to one cluster %v", got)
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// Logical corpora searched by the app
+const (
+	corpusPosts = "posts"
+	corpusFeeds = "feeds"
+)
+
+// Corpus maps a logical corpus to the Pinecone index and namespace holding
+// it, and to the names of its metadata fields. Host and Index default to the
+// PINECONE_V2_* environment variables.
+type Corpus struct {
+	Name      string       `json:"-"`
+	Host      string       `json:"host,omitempty"`
+	Index     string       `json:"index,omitempty"`
+	Namespace string       `json:"namespace"`
+	Fields    CorpusFields `json:"fields"`
+
+	client *PineconeClient
+}
+
+// CorpusFields names the metadata fields of a corpus. An empty name means
+// the corpus doesn't have that field.
+type CorpusFields struct {
+	BaseURL     string   `json:"base_url"`
+	Title       []string `json:"title"` // the first non-empty one is shown
+	Subtitle    string   `json:"subtitle"`
+	Published   string   `json:"published"` // date string shown on results
+	Time        string   `json:"time"`      // unix seconds used by time filters
+	Length      string   `json:"length"`
+	Quality     string   `json:"quality"`
+	Lang        string   `json:"lang"`
+	ContentType string   `json:"content_type"`
+	SiteType    string   `json:"site_type"`
+	OwnerType   string   `json:"owner_type"`
+}
+
+// corpora is the registry consulted by every query path. It holds the
+// built-in corpora until main loads the configured ones.
+var corpora = defaultCorpora()
+
+// defaultCorpora returns the built-in posts and feeds corpora
+func defaultCorpora() map[string]*Corpus {
+	return map[string]*Corpus{
+		corpusPosts: {
+			Name:      corpusPosts,
+			Namespace: "blaze-content-v3",
+			Fields: CorpusFields{
+				BaseURL:     "base_url",
+				Title:       []string{"title"},
+				Subtitle:    "subtitle",
+				Published:   "dt_published",
+				Time:        "unix_time",
+				Length:      "length",
+				Quality:     "score",
+				Lang:        "lang",
+				ContentType: "rsstype",
+				SiteType:    "site_type",
+				OwnerType:   "owner_type",
+			},
+		},
+		corpusFeeds: {
+			Name:      corpusFeeds,
+			Namespace: "blaze-feeds-v3",
+			Fields: CorpusFields{
+				BaseURL:     "baseurl",
+				Title:       []string{"owner_name", "title"},
+				Subtitle:    "short_summary",
+				Time:        "unix_time",
+				Length:      "length",
+				Quality:     "score",
+				Lang:        "lang",
+				ContentType: "rsstype",
+				SiteType:    "site_type",
+				OwnerType:   "owner_type",
+			},
+		},
+	}
+}
+
+// loadCorpora reads the corpus registry from a JSON file keyed by corpus
+// name. Entries for posts and feeds override the built-in corpora field by
+// field, so moving to a new namespace only needs its "namespace". Other
+// entries define new corpora. An empty path returns the built-in corpora.
+func loadCorpora(path string) (map[string]*Corpus, error) {
+	registry := defaultCorpora()
+	if path == "" {
+		return registry, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read corpora config: %w", err)
+	}
+	var entries map[string]json.RawMessage
+	if err := json.Unmarshal(data, &entries); err != nil {
+		return nil, fmt.Errorf("failed to parse corpora config %s: %w", path, err)
+	}
+
+	for name, raw := range entries {
+		corpus := registry[name]
+		if corpus == nil {
+			corpus = &Corpus{Name: name}
+			registry[name] = corpus
+		}
+		if err := json.Unmarshal(raw, corpus); err != nil {
+			return nil, fmt.Errorf("invalid corpus %q in %s: %w", name, path, err)
+		}
+		if corpus.Namespace == "" {
+			return nil, fmt.Errorf("corpus %q in %s has no namespace", name, path)
+		}
+		if corpus.Fields.BaseURL == "" {
+			return nil, fmt.Errorf("corpus %q in %s has no base_url field", name, path)
+		}
+	}
+	return registry, nil
+}
+
+// connectCorpora gives each corpus a Pinecone client. Corpora on the default
+// index share defaultClient; the rest share one client per host.
+func connectCorpora(registry map[string]*Corpus, apiKey string, defaultClient *PineconeClient) {
+	clients := map[string]*PineconeClient{defaultClient.host: defaultClient}
+	for _, corpus := range registry {
+		if corpus.Host == "" {
+			corpus.Host = defaultClient.host
+		}
+		if corpus.Index == "" {
+			corpus.Index = defaultClient.index
+		}
+		if clients[corpus.Host] == nil {
+			clients[corpus.Host] = NewPineconeClient(apiKey, corpus.Host, corpus.Index)
+		}
+		corpus.client = clients[corpus.Host]
+	}
+}
+
+// corpusNames lists the registered corpora in order, for logging
+func corpusNames(registry map[string]*Corpus) string {
+	var names []string
+	for name, corpus := range registry {
+		names = append(names, fmt.Sprintf("%s=%s/%s", name, corpus.Index, corpus.Namespace))
+	}
+	sort.Strings(names)
+	return strings.Join(names, ", ")
+}
+
+// corpusFor returns the feeds or posts corpus
+func corpusFor(isFeed bool) *Corpus {
+	if isFeed {
+		return corpora[corpusFeeds]
+	}
+	return corpora[corpusPosts]
+}
+
+// title returns the first non-empty title field of a match
+func (c *Corpus) title(metadata map[string]interface{}) string {
+	for _, field := range c.Fields.Title {
+		if title := getMetadataString(metadata, field); title != "" {
+			return title
+		}
+	}
+	return ""
+}
+
+// field reads a string metadata field, returning "" if the corpus lacks it
+func (c *Corpus) field(metadata map[string]interface{}, field string) string {
+	if field == "" {
+		return ""
+	}
+	return getMetadataString(metadata, field)
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeCorpora writes a corpora config into a temporary directory
+func writeCorpora(t *testing.T, config string) string {
+	path := filepath.Join(t.TempDir(), "corpora.json")
+	if err := os.WriteFile(path, []byte(config), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadCorporaDefaults(t *testing.T) {
+	registry, err := loadCorpora("")
+	if err != nil || !reflect.DeepEqual(registry, defaultCorpora()) {
+		t.Errorf("no config: %v, %v", registry, err)
+	}
+}
+
+func TestLoadCorporaMerges(t *testing.T) {
+	path := writeCorpora(t, `{
+		"posts": {"namespace": "blaze-content-v4", "fields": {"subtitle": "summary"}},
+		"podcasts": {"host": "https://podcasts.example.com", "namespace": "episodes",
+			"fields": {"base_url": "show_url", "title": ["episode_title"]}}
+	}`)
+	registry, err := loadCorpora(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only the fields the entry sets change
+	posts := registry[corpusPosts]
+	wantPosts := defaultCorpora()[corpusPosts]
+	wantPosts.Namespace = "blaze-content-v4"
+	wantPosts.Fields.Subtitle = "summary"
+	if !reflect.DeepEqual(posts, wantPosts) {
+		t.Errorf("posts %+v, want %+v", posts, wantPosts)
+	}
+	if !reflect.DeepEqual(registry[corpusFeeds], defaultCorpora()[corpusFeeds]) {
+		t.Errorf("feeds changed without an entry: %+v", registry[corpusFeeds])
+	}
+
+	podcasts := registry["podcasts"]
+	want := &Corpus{
+		Name:      "podcasts",
+		Host:      "https://podcasts.example.com",
+		Namespace: "episodes",
+		Fields:    CorpusFields{BaseURL: "show_url", Title: []string{"episode_title"}},
+	}
+	if !reflect.DeepEqual(podcasts, want) {
+		t.Errorf("podcasts %+v, want %+v", podcasts, want)
+	}
+}
+
+func TestLoadCorporaErrors(t *testing.T) {
+	tests := []struct {
+		name, config, want string
+	}{
+		{"invalid JSON", `{"posts": `, "failed to parse"},
+		{"invalid entry", `{"posts": {"namespace": 3}}`, `invalid corpus "posts"`},
+		{"cleared namespace", `{"feeds": {"namespace": ""}}`, `corpus "feeds"`},
+		{"new corpus without namespace", `{"podcasts": {"fields": {"base_url": "url"}}}`, `corpus "podcasts"`},
+		{"new corpus without base_url", `{"podcasts": {"namespace": "episodes"}}`, "no base_url field"},
+	}
+	for _, tt := range tests {
+		_, err := loadCorpora(writeCorpora(t, tt.config))
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("%s: error %v, want one mentioning %q", tt.name, err, tt.want)
+		}
+	}
+
+	if _, err := loadCorpora(filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("missing config: no error")
+	}
+}
+
+func TestConnectCorpora(t *testing.T) {
+	registry := defaultCorpora()
+	registry["podcasts"] = &Corpus{Name: "podcasts", Host: "https://podcasts.example.com", Index: "shows"}
+	registry["archive"] = &Corpus{Name: "archive", Host: "https://podcasts.example.com"}
+	defaultClient := NewPineconeClient("key", "https://default.example.com", "blaze")
+	connectCorpora(registry, "key", defaultClient)
+
+	posts, feeds := registry[corpusPosts], registry[corpusFeeds]
+	if posts.client != defaultClient || feeds.client != defaultClient || posts.Index != "blaze" {
+		t.Errorf("built-in corpora don't share the default client: %+v", posts)
+	}
+	podcasts, archive := registry["podcasts"], registry["archive"]
+	if podcasts.client == defaultClient || podcasts.client != archive.client {
+		t.Error("corpora on one host don't share a client of their own")
+	}
+	if podcasts.client.host != "https://podcasts.example.com" || archive.Index != "blaze" {
+		t.Errorf("podcasts client %+v, archive index %q", podcasts.client, archive.Index)
+	}
+}
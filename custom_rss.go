@@ -1,6 +1,7 @@
 package main
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
@@ -40,7 +41,11 @@ func (app *App) handleCustomRSSPost(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Process the workflow
-	results, err := app.processCustomRSSWorkflow(&config)
+	results, err := app.processCustomRSSWorkflow(r.Context(), &config)
+	if isUpstreamFailure(err) {
+		writeUnavailable(w, err)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error processing workflow: %v", err), http.StatusInternalServerError)
 		return
@@ -85,17 +90,11 @@ func (app *App) handleCustomRSSFeed(w http.ResponseWriter, r *http.Request) {
 
 	// Check cache first
 	cacheKey := "custom-rss:" + configParam
-	app.rssMutex.RLock()
-	if cached, exists := app.rssCache[cacheKey]; exists {
-		// Cache for 10 minutes
-		if time.Since(cached.timestamp) < 10*time.Minute {
-			app.rssMutex.RUnlock()
-			w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
-			w.Write([]byte(cached.content))
-			return
-		}
+	if content, ok := app.cachedRSS(cacheKey, rssCacheTTL); ok {
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		w.Write([]byte(content))
+		return
 	}
-	app.rssMutex.RUnlock()
 
 	// Decode the configuration (URL-encoded instead of base64)
 	configJSON, err := url.QueryUnescape(configParam)
@@ -112,7 +111,11 @@ func (app *App) handleCustomRSSFeed(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Process the workflow
-	results, err := app.processCustomRSSWorkflow(&config)
+	results, err := app.processCustomRSSWorkflow(r.Context(), &config)
+	if isUpstreamFailure(err) {
+		app.serveStaleRSS(w, cacheKey, err)
+		return
+	}
 	if err != nil {
 		http.Error(w, fmt.Sprintf("Error processing workflow: %v", err), http.StatusInternalServerError)
 		return
@@ -141,24 +144,18 @@ func (app *App) handleCustomRSSFeed(w http.ResponseWriter, r *http.Request) {
 	}
 
 	rssContent := app.generateCustomRSSFeed(results, title, description, r)
-
-	// Cache the result
-	app.rssMutex.Lock()
-	app.rssCache[cacheKey] = RSSCacheItem{
-		content:   rssContent,
-		timestamp: time.Now(),
-	}
-	app.rssMutex.Unlock()
-
-	// Clean old cache entries occasionally
-	go app.cleanRSSCache()
+	app.storeRSS(cacheKey, rssContent)
 
 	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
 	w.Write([]byte(rssContent))
 }
 
+// workflowSourceWorkers bounds the source searches a workflow runs at once
+const workflowSourceWorkers = 8
+
 // processCustomRSSWorkflow executes the custom RSS workflow and returns results
-func (app *App) processCustomRSSWorkflow(config *CustomRSSConfig) ([]SearchResult, error) {
+func (app *App) processCustomRSSWorkflow(ctx context.Context, config *CustomRSSConfig) ([]SearchResult, error) {
+	ctx = withUsagePath(ctx, usageWorkflow)
 	var allResults []SearchResult
 
 	// Find source nodes
@@ -186,26 +183,27 @@ func (app *App) processCustomRSSWorkflow(config *CustomRSSConfig) ([]SearchResul
 		return nil, fmt.Errorf("no output node found in workflow")
 	}
 
+	// Search every source at once, so their embeddings share a batch
+	sourceResults := make([][]SearchResult, len(sourceNodes))
+	sourceErrs := make([]error, len(sourceNodes))
+	forEachConcurrently(len(sourceNodes), workflowSourceWorkers, func(i int) {
+		sourceResults[i], sourceErrs[i] = app.processSearchSource(ctx, &sourceNodes[i])
+	})
+
 	// Process each source independently through its path
-	for _, sourceNode := range sourceNodes {
-		var sourceResults []SearchResult
-		var err error
-
-		switch sourceNode.Type {
-		case "search-source":
-			sourceResults, err = app.processSearchSource(&sourceNode)
-		default:
-			log.Printf("Unknown source node type: %s", sourceNode.Type)
-			continue
+	for i, sourceNode := range sourceNodes {
+		err := sourceErrs[i]
+		if isUpstreamFailure(err) {
+			// A feed missing this source would drop its items for readers
+			return nil, err
 		}
-
 		if err != nil {
 			log.Printf("Error processing source node %s: %v", sourceNode.ID, err)
 			continue
 		}
 
 		// Process this source through its specific path
-		pathResults := app.processPath(sourceNode.ID, sourceResults, outputNode.ID, config)
+		pathResults := app.processPath(sourceNode.ID, sourceResults[i], outputNode.ID, config)
 		allResults = append(allResults, pathResults...)
 	}
 
@@ -224,7 +222,7 @@ func (app *App) processCustomRSSWorkflow(config *CustomRSSConfig) ([]SearchResul
 
 
 // processSearchSource executes a search query
-func (app *App) processSearchSource(node *CustomRSSNode) ([]SearchResult, error) {
+func (app *App) processSearchSource(ctx context.Context, node *CustomRSSNode) ([]SearchResult, error) {
 	if node == nil {
 		return nil, fmt.Errorf("node cannot be nil")
 	}
@@ -255,14 +253,26 @@ func (app *App) processSearchSource(node *CustomRSSNode) ([]SearchResult, error)
 		}
 	}
 
-	// Create params for the search
-	params := map[string][]string{
-		"qry":  {query},
-		"type": {searchType},
+	// Build the search request from the node's inputs
+	req := &SearchRequest{Text: query}
+	switch searchType {
+	case "feeds":
+		req.Namespace = "feeds"
+	case "blogs", "news":
+		req.Filters.Content = []string{searchType}
+	}
+	if since, ok := node.Inputs["since"].(string); ok && since != "" {
+		req.Filters.Since, req.Filters.Until = timeParamBounds(since)
+	}
+	if lang, ok := node.Inputs["lang"].(string); ok && lang != "" {
+		req.Filters.Langs = []string{lang}
 	}
 
-	results, _ := app.performSearch(query, params)
-	return results, nil
+	response, err := app.performSearch(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return response.Results, nil
 }
 
 // applyCustomFilters applies keyword and regex filters to results
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+)
+
+// rssPerDomain caps posts per site in /rss feeds, so that one prolific blog
+// can't crowd out the rest of a subscription
+const rssPerDomain = 3
+
+// parsePerDomain parses a perdomain: value, which must allow at least one
+// post per site
+func parsePerDomain(value string) (int, error) {
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("%q is not a positive whole number of posts", value)
+	}
+	return n, nil
+}
+
+// parseDiversity parses a diversity: value between 0 (pure relevance) and 1
+func parseDiversity(value string) (float64, error) {
+	d, err := strconv.ParseFloat(value, 64)
+	if err != nil || d < 0 || d > 1 {
+		return 0, fmt.Errorf("%q must be a number from 0 to 1", value)
+	}
+	return d, nil
+}
+
+// diversifyResults reorders results with maximal marginal relevance. Each
+// step picks the result with the best trade-off between its own score and
+// its similarity to results already picked, weighted by diversity. Results
+// without vectors, such as lexical hits, are treated as dissimilar to all.
+func diversifyResults(results []SearchResult, diversity float64) []SearchResult {
+	if diversity <= 0 || len(results) < 2 {
+		return results
+	}
+
+	vectors := make([][]float64, len(results))
+	for i := range results {
+		if len(results[i].vector) > 0 {
+			vectors[i] = normalizeVector(results[i].vector)
+		}
+	}
+
+	// maxSim[i] is the highest similarity of candidate i to any picked result
+	maxSim := make([]float64, len(results))
+	picked := make([]bool, len(results))
+	ordered := make([]SearchResult, 0, len(results))
+	for len(ordered) < len(results) {
+		best, bestValue := -1, 0.0
+		for i := range results {
+			if picked[i] {
+				continue
+			}
+			value := (1-diversity)*results[i].rankedScore() - diversity*maxSim[i]
+			if best < 0 || value > bestValue {
+				best, bestValue = i, value
+			}
+		}
+
+		picked[best] = true
+		ordered = append(ordered, results[best])
+		if vectors[best] == nil {
+			continue
+		}
+		for i := range results {
+			if !picked[i] && vectors[i] != nil {
+				if sim := dotProduct(vectors[i], vectors[best]); sim > maxSim[i] {
+					maxSim[i] = sim
+				}
+			}
+		}
+	}
+	return ordered
+}
+
+// capPerDomain keeps at most limit results from each site, in order
+func capPerDomain(results []SearchResult, limit int) []SearchResult {
+	if limit <= 0 {
+		return results
+	}
+	counts := make(map[string]int)
+	capped := make([]SearchResult, 0, len(results))
+	for _, result := range results {
+		domain := getStringDefault(result.BaseDomain, result.URL)
+		if counts[domain] >= limit {
+			continue
+		}
+		counts[domain]++
+		capped = append(capped, result)
+	}
+	return capped
+}
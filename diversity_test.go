@@ -0,0 +1,103 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+// crowdedResults has five near-identical posts from one site ranked above
+// three distinct posts from others
+func crowdedResults() []SearchResult {
+	return []SearchResult{
+		{URL: "a1", BaseDomain: "a.com", Score: 0.90, vector: []float64{1, 0, 0}},
+		{URL: "a2", BaseDomain: "a.com", Score: 0.89, vector: []float64{1, 0.01, 0}},
+		{URL: "a3", BaseDomain: "a.com", Score: 0.88, vector: []float64{1, 0, 0.01}},
+		{URL: "a4", BaseDomain: "a.com", Score: 0.87, vector: []float64{1, 0.01, 0.01}},
+		{URL: "a5", BaseDomain: "a.com", Score: 0.86, vector: []float64{1, 0.02, 0}},
+		{URL: "b1", BaseDomain: "b.com", Score: 0.60, vector: []float64{0, 1, 0}},
+		{URL: "c1", BaseDomain: "c.com", Score: 0.55, vector: []float64{0, 0, 1}},
+		{URL: "d1", BaseDomain: "d.com", Score: 0.50},
+	}
+}
+
+func TestDiversifyResults(t *testing.T) {
+	results := crowdedResults()
+	if got := resultURLs(diversifyResults(results, 0)); !reflect.DeepEqual(got, resultURLs(results)) {
+		t.Errorf("diversity 0 reordered results: %v", got)
+	}
+
+	diversified := diversifyResults(crowdedResults(), 0.5)
+	if len(diversified) != len(results) {
+		t.Fatalf("%d results, want all %d", len(diversified), len(results))
+	}
+	// The best result stays first, and the distinct posts, including the one
+	// without a vector, rise above the near-duplicates
+	want := []string{"a1", "b1", "c1", "d1", "a2", "a3", "a4", "a5"}
+	if got := resultURLs(diversified); !reflect.DeepEqual(got, want) {
+		t.Errorf("diversified %v, want %v", got, want)
+	}
+
+	page := diversified[:4]
+	fromA := 0
+	for _, result := range page {
+		if result.BaseDomain == "a.com" {
+			fromA++
+		}
+	}
+	if fromA > 1 {
+		t.Errorf("a.com fills %d of the first 4 results", fromA)
+	}
+}
+
+func TestCapPerDomain(t *testing.T) {
+	results := []SearchResult{
+		{URL: "a1", BaseDomain: "a.com"},
+		{URL: "b1", BaseDomain: "b.com"},
+		{URL: "a2", BaseDomain: "a.com"},
+		{URL: "a3", BaseDomain: "a.com"},
+		{URL: "x", BaseDomain: ""},
+		{URL: "x", BaseDomain: ""},
+		{URL: "b2", BaseDomain: "b.com"},
+	}
+	// Results without a domain are capped by URL
+	want := []string{"a1", "b1", "a2", "x", "x", "b2"}
+	if got := resultURLs(capPerDomain(results, 2)); !reflect.DeepEqual(got, want) {
+		t.Errorf("capped %v, want %v", got, want)
+	}
+	want = []string{"a1", "b1", "x"}
+	if got := resultURLs(capPerDomain(results, 1)); !reflect.DeepEqual(got, want) {
+		t.Errorf("capped to 1: %v, want %v", got, want)
+	}
+	if got := capPerDomain(results, 0); len(got) != len(results) {
+		t.Errorf("no cap kept %d of %d results", len(got), len(results))
+	}
+}
+
+func TestParsePerDomainAndDiversity(t *testing.T) {
+	if n, err := parsePerDomain("3"); n != 3 || err != nil {
+		t.Errorf("perdomain:3 = %d, %v", n, err)
+	}
+	for _, value := range []string{"0", "-1", "1.5", "many", ""} {
+		if _, err := parsePerDomain(value); err == nil {
+			t.Errorf("perdomain:%s: no error", value)
+		}
+	}
+
+	for value, want := range map[string]float64{"0": 0, "0.3": 0.3, "1": 1} {
+		if d, err := parseDiversity(value); d != want || err != nil {
+			t.Errorf("diversity:%s = %v, %v", value, d, err)
+		}
+	}
+	for _, value := range []string{"-0.1", "1.5", "high"} {
+		if _, err := parseDiversity(value); err == nil {
+			t.Errorf("diversity:%s: no error", value)
+		}
+	}
+
+	// Both are reported as query errors at the operator
+	for _, query := range []string{"rust perdomain:0", "rust diversity:2"} {
+		if _, err := parseSearchQuery(query); queryErrorFields(err) == nil {
+			t.Errorf("%q: error %v, want a query error", query, err)
+		}
+	}
+}
@@ -0,0 +1,226 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Embedding batch defaults
+const (
+	defaultEmbedBatchWindow = 5 * time.Millisecond
+	defaultEmbedBatchSize   = 64
+)
+
+// EmbeddingBatcher gathers the embedding calls made within a short window
+// into one batched request per input type, so simultaneous searches, RSS
+// refreshes and workflow sources share a round trip. Identical texts waiting
+// or in flight are embedded once and shared, like singleflight.
+//
+// A batch outlives the call that started it, so it runs under its own
+// context, which is cancelled once every caller waiting on it has given up.
+// The tokens billed for a batch are recorded against the request paths of
+// its callers.
+type EmbeddingBatcher struct {
+	embedder Embedder
+	window   time.Duration
+	size     int
+	usage    *UsageLedger
+
+	mu       sync.Mutex
+	pending  map[string]*embeddingBatch // by input type, not yet sent
+	inflight map[string]*embeddingCall  // by input type and text, until answered
+}
+
+// embeddingBatch is the texts of one input type sent in one request
+type embeddingBatch struct {
+	inputType string
+	calls     []*embeddingCall
+	timer     *time.Timer
+	ctx       context.Context
+	cancel    context.CancelFunc
+	waiters   int // callers still waiting on any call in the batch
+}
+
+// embeddingCall is one distinct text, shared by every caller asking for it
+type embeddingCall struct {
+	key       string
+	text      string
+	path      string // the request path of the first caller
+	batch     *embeddingBatch
+	done      chan struct{}
+	embedding []float64
+	err       error
+}
+
+// NewEmbeddingBatcher batches calls to embedder made within window, sending
+// at most size texts per request, and records their usage. A zero window
+// sends each call at once, but still shares identical texts.
+func NewEmbeddingBatcher(embedder Embedder, window time.Duration, size int, usage *UsageLedger) *EmbeddingBatcher {
+	if size <= 0 {
+		size = defaultEmbedBatchSize
+	}
+	return &EmbeddingBatcher{
+		embedder: embedder,
+		window:   window,
+		size:     size,
+		usage:    usage,
+		pending:  make(map[string]*embeddingBatch),
+		inflight: make(map[string]*embeddingCall),
+	}
+}
+
+func (eb *EmbeddingBatcher) Model() string {
+	return eb.embedder.Model()
+}
+
+func (eb *EmbeddingBatcher) GetEmbeddingWithType(ctx context.Context, text string, inputType string) ([]float64, error) {
+	if text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+	return eb.wait(ctx, eb.join(ctx, text, inputType))
+}
+
+// GetEmbeddings joins every text to the current batch and waits for them all
+func (eb *EmbeddingBatcher) GetEmbeddings(ctx context.Context, texts []string, inputType string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("texts cannot be empty")
+	}
+	calls := make([]*embeddingCall, len(texts))
+	for i, text := range texts {
+		calls[i] = eb.join(ctx, text, inputType)
+	}
+
+	embeddings := make([][]float64, len(texts))
+	var firstErr error
+	for i, call := range calls {
+		if firstErr != nil {
+			// Release the remaining calls so their batches can be cancelled
+			eb.leave(call)
+			continue
+		}
+		embeddings[i], firstErr = eb.wait(ctx, call)
+	}
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return embeddings, nil
+}
+
+// join registers a caller for text, sharing a call already waiting or in
+// flight for the same text
+func (eb *EmbeddingBatcher) join(ctx context.Context, text, inputType string) *embeddingCall {
+	key := inputType + "\x00" + text
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+
+	// A call whose batch every caller abandoned is cancelled, so start afresh
+	if call, ok := eb.inflight[key]; ok && call.batch.ctx.Err() == nil {
+		call.batch.waiters++
+		return call
+	}
+
+	batch := eb.pending[inputType]
+	if batch == nil {
+		ctx, cancel := context.WithCancel(context.Background())
+		batch = &embeddingBatch{inputType: inputType, ctx: ctx, cancel: cancel}
+		eb.pending[inputType] = batch
+		if eb.window > 0 {
+			batch.timer = time.AfterFunc(eb.window, func() { eb.flush(batch) })
+		}
+	}
+	call := &embeddingCall{key: key, text: text, path: usagePathOf(ctx), batch: batch, done: make(chan struct{})}
+	batch.calls = append(batch.calls, call)
+	batch.waiters++
+	eb.inflight[key] = call
+
+	if eb.window <= 0 || len(batch.calls) >= eb.size {
+		if batch.timer != nil {
+			batch.timer.Stop()
+		}
+		eb.send(batch)
+	}
+	return call
+}
+
+// wait returns the result of call, or gives up when ctx is done
+func (eb *EmbeddingBatcher) wait(ctx context.Context, call *embeddingCall) ([]float64, error) {
+	select {
+	case <-call.done:
+		return call.embedding, call.err
+	case <-ctx.Done():
+		eb.leave(call)
+		return nil, ctx.Err()
+	}
+}
+
+// leave drops a caller that stopped waiting. When no callers are left, the
+// batch is cancelled, or dropped if it hasn't been sent.
+func (eb *EmbeddingBatcher) leave(call *embeddingCall) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	batch := call.batch
+	batch.waiters--
+	if batch.waiters > 0 {
+		return
+	}
+	batch.cancel()
+	if eb.pending[batch.inputType] == batch {
+		batch.timer.Stop()
+		delete(eb.pending, batch.inputType)
+		eb.finish(batch, nil, context.Canceled)
+	}
+}
+
+// flush sends a batch when its window closes, unless it was already sent
+// for being full
+func (eb *EmbeddingBatcher) flush(batch *embeddingBatch) {
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	if eb.pending[batch.inputType] == batch {
+		eb.send(batch)
+	}
+}
+
+// send removes a batch from pending and requests it in the background. The
+// caller holds eb.mu.
+func (eb *EmbeddingBatcher) send(batch *embeddingBatch) {
+	delete(eb.pending, batch.inputType)
+	texts := make([]string, len(batch.calls))
+	for i, call := range batch.calls {
+		texts[i] = call.text
+	}
+	go eb.run(batch, texts)
+}
+
+// run makes the batched request and hands each caller its embedding
+func (eb *EmbeddingBatcher) run(batch *embeddingBatch, texts []string) {
+	defer batch.cancel()
+	ctx, sink := withUsageSink(batch.ctx)
+	embeddings, err := eb.embedder.GetEmbeddings(ctx, texts, batch.inputType)
+	if err == nil && eb.usage != nil {
+		eb.usage.recordBatch(batch.calls, atomic.LoadInt64(&sink.tokens))
+	}
+
+	eb.mu.Lock()
+	defer eb.mu.Unlock()
+	eb.finish(batch, embeddings, err)
+}
+
+// finish answers every call in a batch. The caller holds eb.mu.
+func (eb *EmbeddingBatcher) finish(batch *embeddingBatch, embeddings [][]float64, err error) {
+	for i, call := range batch.calls {
+		if err != nil {
+			call.err = err
+		} else {
+			call.embedding = embeddings[i]
+		}
+		// A newer call may have replaced an abandoned one
+		if eb.inflight[call.key] == call {
+			delete(eb.inflight, call.key)
+		}
+		close(call.done)
+	}
+}
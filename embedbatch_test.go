@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeEmbedder embeds a text as its length and records each request
+type fakeEmbedder struct {
+	mu       sync.Mutex
+	requests [][]string
+	err      error
+	block    chan struct{} // if set, requests wait for it to close
+}
+
+func (fe *fakeEmbedder) Model() string {
+	return "fake"
+}
+
+func (fe *fakeEmbedder) GetEmbeddingWithType(ctx context.Context, text string, inputType string) ([]float64, error) {
+	embeddings, err := fe.GetEmbeddings(ctx, []string{text}, inputType)
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+func (fe *fakeEmbedder) GetEmbeddings(ctx context.Context, texts []string, inputType string) ([][]float64, error) {
+	fe.mu.Lock()
+	fe.requests = append(fe.requests, texts)
+	fe.mu.Unlock()
+	if fe.block != nil {
+		select {
+		case <-fe.block:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+	if fe.err != nil {
+		return nil, fe.err
+	}
+	embeddings := make([][]float64, len(texts))
+	tokens := 0
+	for i, text := range texts {
+		embeddings[i] = []float64{float64(len(text))}
+		tokens += len(text)
+	}
+	reportEmbeddingTokens(ctx, tokens)
+	return embeddings, nil
+}
+
+func (fe *fakeEmbedder) requestCount() int {
+	fe.mu.Lock()
+	defer fe.mu.Unlock()
+	return len(fe.requests)
+}
+
+func TestEmbeddingBatcherBatches(t *testing.T) {
+	fake := &fakeEmbedder{}
+	usage := NewUsageLedger(0)
+	batcher := NewEmbeddingBatcher(fake, 20*time.Millisecond, 64, usage)
+
+	texts := []string{"a", "bb", "ccc", "bb", "a"}
+	var wg sync.WaitGroup
+	results := make([][]float64, len(texts))
+	errs := make([]error, len(texts))
+	for i, text := range texts {
+		wg.Add(1)
+		go func(i int, text string) {
+			defer wg.Done()
+			ctx := withUsagePath(context.Background(), usageSearch)
+			results[i], errs[i] = batcher.GetEmbeddingWithType(ctx, text, "query")
+		}(i, text)
+	}
+	wg.Wait()
+
+	for i, text := range texts {
+		if errs[i] != nil || len(results[i]) != 1 || results[i][0] != float64(len(text)) {
+			t.Errorf("%q: embedding %v, error %v", text, results[i], errs[i])
+		}
+	}
+	fake.mu.Lock()
+	requests := fake.requests
+	fake.mu.Unlock()
+	if len(requests) != 1 || len(requests[0]) != 3 {
+		t.Fatalf("requests %q, want one request of the 3 distinct texts", requests)
+	}
+
+	today := usage.Report().Days[0].Paths[usageSearch]
+	if today.Tokens != 6 || today.Texts != 3 {
+		t.Errorf("usage %+v, want 6 tokens for 3 texts", today)
+	}
+}
+
+func TestEmbeddingBatcherSize(t *testing.T) {
+	fake := &fakeEmbedder{}
+	batcher := NewEmbeddingBatcher(fake, time.Hour, 2, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	embeddings, err := batcher.GetEmbeddings(ctx, []string{"a", "bb", "ccc", "dddd"}, "document")
+	if err != nil {
+		t.Fatalf("full batches should be sent without waiting for the window: %v", err)
+	}
+	if len(embeddings) != 4 || embeddings[3][0] != 4 {
+		t.Errorf("embeddings %v", embeddings)
+	}
+	if fake.requestCount() != 2 {
+		t.Errorf("%d requests, want 2 requests of 2 texts", fake.requestCount())
+	}
+}
+
+func TestEmbeddingBatcherInputTypes(t *testing.T) {
+	fake := &fakeEmbedder{}
+	batcher := NewEmbeddingBatcher(fake, 0, 64, nil)
+
+	if _, err := batcher.GetEmbeddingWithType(context.Background(), "a", "query"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := batcher.GetEmbeddingWithType(context.Background(), "a", "document"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.requestCount() != 2 {
+		t.Errorf("%d requests, want one per input type", fake.requestCount())
+	}
+}
+
+func TestEmbeddingBatcherError(t *testing.T) {
+	fake := &fakeEmbedder{err: errors.New("upstream down")}
+	batcher := NewEmbeddingBatcher(fake, 5*time.Millisecond, 64, nil)
+
+	var wg sync.WaitGroup
+	for _, text := range []string{"a", "b"} {
+		wg.Add(1)
+		go func(text string) {
+			defer wg.Done()
+			if _, err := batcher.GetEmbeddingWithType(context.Background(), text, "query"); err != fake.err {
+				t.Errorf("%q: error %v, want %v", text, err, fake.err)
+			}
+		}(text)
+	}
+	wg.Wait()
+}
+
+func TestEmbeddingBatcherAbandoned(t *testing.T) {
+	fake := &fakeEmbedder{}
+	batcher := NewEmbeddingBatcher(fake, 50*time.Millisecond, 64, nil)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Millisecond)
+	defer cancel()
+	if _, err := batcher.GetEmbeddingWithType(ctx, "a", "query"); err != context.DeadlineExceeded {
+		t.Fatalf("error %v, want the caller's deadline", err)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if fake.requestCount() != 0 {
+		t.Errorf("a batch every caller abandoned before it was sent was still requested")
+	}
+
+	// A later caller of the same text starts a new call
+	if _, err := batcher.GetEmbeddingWithType(context.Background(), "a", "query"); err != nil {
+		t.Errorf("retry after abandoning: %v", err)
+	}
+}
+
+func TestEmbeddingBatcherCancelsInFlight(t *testing.T) {
+	fake := &fakeEmbedder{block: make(chan struct{})}
+	defer close(fake.block)
+	batcher := NewEmbeddingBatcher(fake, 0, 64, nil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		_, err := batcher.GetEmbeddingWithType(ctx, "a", "query")
+		done <- err
+	}()
+	for fake.requestCount() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != context.Canceled {
+		t.Fatalf("error %v, want context.Canceled", err)
+	}
+
+	// The abandoned request is cancelled, so a new caller gets a fresh one
+	go batcher.GetEmbeddingWithType(context.Background(), "a", "query")
+	for fake.requestCount() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,269 @@
+package main
+
+import (
+	"container/list"
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// defaultEmbedCacheSize is the number of embeddings kept in memory, about
+// 80MB of 1024-dimension vectors
+const defaultEmbedCacheSize = 10000
+
+// EmbeddingCache wraps an Embedder with an in-memory LRU of embeddings
+// keyed by model, input type and text. With a directory, embeddings are also
+// written to disk so they survive restarts; a memory miss checks the disk
+// before calling the embedder. Cached vectors are shared, so callers must not
+// modify them.
+type EmbeddingCache struct {
+	embedder Embedder
+	capacity int
+	dir      string
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	order   *list.List // most recently used first
+	stats   EmbeddingCacheStats
+}
+
+// embeddingCacheEntry is one cached embedding in the LRU
+type embeddingCacheEntry struct {
+	key       string
+	embedding []float64
+}
+
+// EmbeddingCacheStats counts cache lookups. Misses are the texts sent to
+// the embedder.
+type EmbeddingCacheStats struct {
+	Entries    int     `json:"entries"`
+	Capacity   int     `json:"capacity"`
+	Persistent bool    `json:"persistent"`
+	MemoryHits int64   `json:"memory_hits"`
+	DiskHits   int64   `json:"disk_hits"`
+	Misses     int64   `json:"misses"`
+	Evictions  int64   `json:"evictions"`
+	DiskErrors int64   `json:"disk_errors"`
+	HitRate    float64 `json:"hit_rate"`
+}
+
+// NewEmbeddingCache caches up to capacity embeddings from embedder in
+// memory, and in dir when it isn't empty
+func NewEmbeddingCache(embedder Embedder, capacity int, dir string) (*EmbeddingCache, error) {
+	if capacity <= 0 {
+		return nil, fmt.Errorf("embedding cache size must be positive, got %d", capacity)
+	}
+	if dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return nil, fmt.Errorf("failed to create embedding cache directory: %w", err)
+		}
+	}
+	return &EmbeddingCache{
+		embedder: embedder,
+		capacity: capacity,
+		dir:      dir,
+		entries:  make(map[string]*list.Element),
+		order:    list.New(),
+	}, nil
+}
+
+func (ec *EmbeddingCache) Model() string {
+	return ec.embedder.Model()
+}
+
+func (ec *EmbeddingCache) GetEmbedding(ctx context.Context, text string) ([]float64, error) {
+	return ec.GetEmbeddingWithType(ctx, text, "query")
+}
+
+func (ec *EmbeddingCache) GetEmbeddingWithType(ctx context.Context, text string, inputType string) ([]float64, error) {
+	key := ec.key(inputType, text)
+	if embedding := ec.lookup(key); embedding != nil {
+		return embedding, nil
+	}
+
+	embedding, err := ec.embedder.GetEmbeddingWithType(ctx, text, inputType)
+	if err != nil {
+		return nil, err
+	}
+	ec.store(key, embedding)
+	return embedding, nil
+}
+
+// GetEmbeddings returns cached embeddings and fetches the rest in one batch
+func (ec *EmbeddingCache) GetEmbeddings(ctx context.Context, texts []string, inputType string) ([][]float64, error) {
+	embeddings := make([][]float64, len(texts))
+	keys := make([]string, len(texts))
+	missing := make(map[string][]int)
+	var missingTexts []string
+	for i, text := range texts {
+		keys[i] = ec.key(inputType, text)
+		if embeddings[i] = ec.lookup(keys[i]); embeddings[i] != nil {
+			continue
+		}
+		if _, ok := missing[keys[i]]; !ok {
+			missingTexts = append(missingTexts, text)
+		}
+		missing[keys[i]] = append(missing[keys[i]], i)
+	}
+	if len(missingTexts) == 0 {
+		return embeddings, nil
+	}
+
+	fetched, err := ec.embedder.GetEmbeddings(ctx, missingTexts, inputType)
+	if err != nil {
+		return nil, err
+	}
+	for j, text := range missingTexts {
+		key := ec.key(inputType, text)
+		ec.store(key, fetched[j])
+		for _, i := range missing[key] {
+			embeddings[i] = fetched[j]
+		}
+	}
+	return embeddings, nil
+}
+
+// Stats returns a snapshot of the cache counters
+func (ec *EmbeddingCache) Stats() EmbeddingCacheStats {
+	ec.mu.Lock()
+	defer ec.mu.Unlock()
+	stats := ec.stats
+	stats.Entries = ec.order.Len()
+	stats.Capacity = ec.capacity
+	stats.Persistent = ec.dir != ""
+	if lookups := stats.MemoryHits + stats.DiskHits + stats.Misses; lookups > 0 {
+		stats.HitRate = float64(stats.MemoryHits+stats.DiskHits) / float64(lookups)
+	}
+	return stats
+}
+
+// key identifies an embedding by everything that determines it
+func (ec *EmbeddingCache) key(inputType, text string) string {
+	return ec.embedder.Model() + "\x00" + inputType + "\x00" + text
+}
+
+// lookup returns a cached embedding from memory or disk, or nil
+func (ec *EmbeddingCache) lookup(key string) []float64 {
+	ec.mu.Lock()
+	if element, ok := ec.entries[key]; ok {
+		ec.order.MoveToFront(element)
+		ec.stats.MemoryHits++
+		ec.mu.Unlock()
+		return element.Value.(*embeddingCacheEntry).embedding
+	}
+	ec.mu.Unlock()
+
+	if ec.dir != "" {
+		embedding, err := readEmbedding(ec.path(key))
+		if err == nil {
+			ec.mu.Lock()
+			ec.stats.DiskHits++
+			ec.insert(key, embedding)
+			ec.mu.Unlock()
+			return embedding
+		}
+		if !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Embedding cache read error: %v", err)
+			ec.mu.Lock()
+			ec.stats.DiskErrors++
+			ec.mu.Unlock()
+		}
+	}
+
+	ec.mu.Lock()
+	ec.stats.Misses++
+	ec.mu.Unlock()
+	return nil
+}
+
+// store caches a fetched embedding in memory and on disk
+func (ec *EmbeddingCache) store(key string, embedding []float64) {
+	ec.mu.Lock()
+	ec.insert(key, embedding)
+	ec.mu.Unlock()
+
+	if ec.dir != "" {
+		if err := writeEmbedding(ec.path(key), embedding); err != nil {
+			log.Printf("Embedding cache write error: %v", err)
+			ec.mu.Lock()
+			ec.stats.DiskErrors++
+			ec.mu.Unlock()
+		}
+	}
+}
+
+// insert adds an embedding to the LRU, evicting the least recently used one
+// when full. The caller holds ec.mu.
+func (ec *EmbeddingCache) insert(key string, embedding []float64) {
+	if element, ok := ec.entries[key]; ok {
+		element.Value.(*embeddingCacheEntry).embedding = embedding
+		ec.order.MoveToFront(element)
+		return
+	}
+	ec.entries[key] = ec.order.PushFront(&embeddingCacheEntry{key: key, embedding: embedding})
+	if ec.order.Len() > ec.capacity {
+		oldest := ec.order.Back()
+		ec.order.Remove(oldest)
+		delete(ec.entries, oldest.Value.(*embeddingCacheEntry).key)
+		ec.stats.Evictions++
+	}
+}
+
+// path returns the file holding an embedding, named by the hash of its key
+// and spread over 256 subdirectories
+func (ec *EmbeddingCache) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(ec.dir, name[:2], name+".bin")
+}
+
+// readEmbedding reads a vector stored as little-endian float64s
+func readEmbedding(path string) ([]float64, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 || len(data)%8 != 0 {
+		return nil, fmt.Errorf("corrupt embedding file %s", path)
+	}
+	embedding := make([]float64, len(data)/8)
+	for i := range embedding {
+		embedding[i] = math.Float64frombits(binary.LittleEndian.Uint64(data[i*8:]))
+	}
+	return embedding, nil
+}
+
+// writeEmbedding stores a vector as little-endian float64s. It writes to a
+// temporary file and renames it, so readers never see a partial vector.
+func writeEmbedding(path string, embedding []float64) error {
+	data := make([]byte, len(embedding)*8)
+	for i, x := range embedding {
+		binary.LittleEndian.PutUint64(data[i*8:], math.Float64bits(x))
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+	"math"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func newTestCache(t *testing.T, embedder Embedder, capacity int, dir string) *EmbeddingCache {
+	cache, err := NewEmbeddingCache(embedder, capacity, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cache
+}
+
+// embed fetches text through cache, failing the test on errors
+func embed(t *testing.T, cache *EmbeddingCache, text string) []float64 {
+	embedding, err := cache.GetEmbeddingWithType(context.Background(), text, "query")
+	if err != nil {
+		t.Fatalf("%q: %v", text, err)
+	}
+	return embedding
+}
+
+func TestEmbeddingCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	fake := &fakeEmbedder{}
+	cache := newTestCache(t, fake, 2, "")
+
+	embed(t, cache, "a")
+	embed(t, cache, "bb")
+	embed(t, cache, "a")   // a is now the most recently used
+	embed(t, cache, "ccc") // evicts bb
+	if fake.requestCount() != 3 {
+		t.Fatalf("%d requests, want a hit for the second a", fake.requestCount())
+	}
+	embed(t, cache, "a")
+	if fake.requestCount() != 3 {
+		t.Error("a was evicted although it was used more recently than bb")
+	}
+	embed(t, cache, "bb")
+	if fake.requestCount() != 4 {
+		t.Error("bb was kept although it was the least recently used")
+	}
+
+	stats := cache.Stats()
+	want := EmbeddingCacheStats{Entries: 2, Capacity: 2, MemoryHits: 2, Misses: 4, Evictions: 2, HitRate: 2.0 / 6}
+	if stats != want {
+		t.Errorf("stats %+v, want %+v", stats, want)
+	}
+}
+
+func TestEmbeddingCacheKeys(t *testing.T) {
+	fake := &fakeEmbedder{}
+	cache := newTestCache(t, fake, 10, "")
+	ctx := context.Background()
+
+	embeddings, err := cache.GetEmbeddings(ctx, []string{"a", "bb", "a"}, "document")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(embeddings, [][]float64{{1}, {2}, {1}}) {
+		t.Errorf("embeddings %v", embeddings)
+	}
+	if len(fake.requests) != 1 || len(fake.requests[0]) != 2 {
+		t.Errorf("requests %q, want one of the distinct texts", fake.requests)
+	}
+
+	// The same text embedded as a query is a different vector
+	if _, err := cache.GetEmbeddingWithType(ctx, "a", "query"); err != nil {
+		t.Fatal(err)
+	}
+	if fake.requestCount() != 2 {
+		t.Error("a document embedding was served for a query")
+	}
+}
+
+func TestEmbeddingCacheErrorsAreNotCached(t *testing.T) {
+	fake := &fakeEmbedder{err: errors.New("upstream down")}
+	cache := newTestCache(t, fake, 10, "")
+	if _, err := cache.GetEmbeddingWithType(context.Background(), "a", "query"); err != fake.err {
+		t.Fatalf("error %v, want %v", err, fake.err)
+	}
+	fake.err = nil
+	embed(t, cache, "a")
+	if fake.requestCount() != 2 {
+		t.Errorf("%d requests, want the failed text fetched again", fake.requestCount())
+	}
+}
+
+func TestEmbeddingFileRoundTrip(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ab", "vector.bin")
+	want := []float64{0.25, -1, 1e-300, math.MaxFloat64, math.Inf(-1)}
+	if err := writeEmbedding(path, want); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readEmbedding(path)
+	if err != nil || !reflect.DeepEqual(got, want) {
+		t.Errorf("read %v, %v, want %v", got, err, want)
+	}
+
+	// No temporary files are left next to the vector
+	entries, _ := os.ReadDir(filepath.Dir(path))
+	if len(entries) != 1 {
+		t.Errorf("%d files in the directory, want 1", len(entries))
+	}
+
+	if _, err := readEmbedding(filepath.Join(t.TempDir(), "missing.bin")); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing file: error %v, want fs.ErrNotExist", err)
+	}
+	for _, size := range []int{0, 12} {
+		if err := os.WriteFile(path, make([]byte, size), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readEmbedding(path); err == nil {
+			t.Errorf("a %d byte file was read as a vector", size)
+		}
+	}
+}
+
+func TestEmbeddingCachePersists(t *testing.T) {
+	dir := t.TempDir()
+	embed(t, newTestCache(t, &fakeEmbedder{}, 10, dir), "rust")
+
+	// A new cache over the same directory reads the vector from disk
+	fake := &fakeEmbedder{}
+	cache := newTestCache(t, fake, 10, dir)
+	if embedding := embed(t, cache, "rust"); embedding[0] != 4 {
+		t.Errorf("embedding %v from disk", embedding)
+	}
+	embed(t, cache, "rust")
+	stats := cache.Stats()
+	if fake.requestCount() != 0 || stats.DiskHits != 1 || stats.MemoryHits != 1 || !stats.Persistent {
+		t.Errorf("%d requests, stats %+v, want one disk hit then one memory hit", fake.requestCount(), stats)
+	}
+
+	// A truncated file counts as a disk error and is fetched and rewritten
+	if err := os.WriteFile(cache.path(cache.key("query", "rust")), []byte{1, 2, 3}, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	fake = &fakeEmbedder{}
+	cache = newTestCache(t, fake, 10, dir)
+	embed(t, cache, "rust")
+	stats = cache.Stats()
+	if fake.requestCount() != 1 || stats.DiskErrors != 1 || stats.Misses != 1 {
+		t.Errorf("%d requests, stats %+v, want the corrupt file counted and refetched", fake.requestCount(), stats)
+	}
+	if got, err := readEmbedding(cache.path(cache.key("query", "rust"))); err != nil || got[0] != 4 {
+		t.Errorf("rewritten file: %v, %v", got, err)
+	}
+}
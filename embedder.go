@@ -0,0 +1,170 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// Embedder turns text into vectors in the space of the indexes. The input
+// type is "query" or "document" for providers that embed them differently.
+// Model names the model, so embeddings from different models are never
+// mixed up.
+type Embedder interface {
+	GetEmbeddingWithType(ctx context.Context, text string, inputType string) ([]float64, error)
+	GetEmbeddings(ctx context.Context, texts []string, inputType string) ([][]float64, error)
+	Model() string
+}
+
+// defaultOpenAIEmbeddingURL is the base URL of the OpenAI embeddings API
+const defaultOpenAIEmbeddingURL = "https://api.openai.com/v1"
+
+// OpenAIEmbeddingClient calls an embeddings API with the request and
+// response shape of OpenAI's /v1/embeddings, which most local embedding
+// servers also accept. Those APIs have no input type, so it is ignored.
+type OpenAIEmbeddingClient struct {
+	apiKey   string
+	endpoint string
+	model    string
+	client   *http.Client
+}
+
+type OpenAIEmbeddingRequest struct {
+	Input []string `json:"input"`
+	Model string   `json:"model"`
+}
+
+type OpenAIEmbeddingResponse struct {
+	Data []struct {
+		Embedding []float64 `json:"embedding"`
+		Index     int       `json:"index"`
+	} `json:"data"`
+	Model string `json:"model"`
+	Usage struct {
+		PromptTokens int `json:"prompt_tokens"`
+		TotalTokens  int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+// NewOpenAIEmbeddingClient embeds with model at baseURL. An empty apiKey
+// sends no Authorization header, for local servers.
+func NewOpenAIEmbeddingClient(apiKey, baseURL, model string) *OpenAIEmbeddingClient {
+	return &OpenAIEmbeddingClient{
+		apiKey:   apiKey,
+		endpoint: strings.TrimSuffix(baseURL, "/") + "/embeddings",
+		model:    model,
+		// Deadlines come from the context of each call
+		client: newRetryingClient("embeddings"),
+	}
+}
+
+func (oc *OpenAIEmbeddingClient) Model() string {
+	return oc.model
+}
+
+func (oc *OpenAIEmbeddingClient) GetEmbeddingWithType(ctx context.Context, text string, inputType string) ([]float64, error) {
+	if text == "" {
+		return nil, fmt.Errorf("text cannot be empty")
+	}
+	embeddings, err := oc.GetEmbeddings(ctx, []string{text}, inputType)
+	if err != nil {
+		return nil, err
+	}
+	return embeddings[0], nil
+}
+
+func (oc *OpenAIEmbeddingClient) GetEmbeddings(ctx context.Context, texts []string, inputType string) ([][]float64, error) {
+	if len(texts) == 0 {
+		return nil, fmt.Errorf("texts cannot be empty")
+	}
+
+	// Build request
+	reqBody := OpenAIEmbeddingRequest{
+		Input: texts,
+		Model: oc.model,
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Make HTTP request
+	req, err := http.NewRequestWithContext(ctx, "POST", oc.endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	// Embedding has no side effects, so it is safe to retry
+	markIdempotent(req)
+	if oc.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+oc.apiKey)
+	}
+
+	resp, err := oc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError("embeddings API", resp)
+	}
+
+	// Parse response
+	var response OpenAIEmbeddingResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	reportEmbeddingTokens(ctx, response.Usage.TotalTokens)
+
+	if len(response.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(response.Data))
+	}
+
+	// Extract embeddings in order
+	embeddings := make([][]float64, len(texts))
+	for _, data := range response.Data {
+		if data.Index < 0 || data.Index >= len(texts) {
+			return nil, fmt.Errorf("invalid index %d in response", data.Index)
+		}
+		embeddings[data.Index] = data.Embedding
+	}
+
+	return embeddings, nil
+}
+
+// checkEmbeddingDimension embeds a probe text and compares its length with
+// the dimension of every index in the registry, so a model that doesn't
+// match an index fails at startup rather than on every query. An embedder or
+// index that can't be reached is only logged, since it may recover.
+func checkEmbeddingDimension(ctx context.Context, embedder Embedder, registry map[string]*Corpus) error {
+	probe, err := embedder.GetEmbeddingWithType(ctx, "content", "query")
+	if err != nil {
+		log.Printf("Warning: couldn't check the embedding dimension of %s: %v", embedder.Model(), err)
+		return nil
+	}
+
+	checked := make(map[*PineconeClient]bool)
+	for _, corpus := range registry {
+		if checked[corpus.client] {
+			continue
+		}
+		checked[corpus.client] = true
+		dimension, err := corpus.client.IndexDimension(ctx)
+		if err != nil {
+			log.Printf("Warning: couldn't read the dimension of index %s: %v", corpus.Index, err)
+			continue
+		}
+		if dimension != len(probe) {
+			return fmt.Errorf("%s embeddings have %d dimensions but index %s (corpus %s) has %d", embedder.Model(), len(probe), corpus.Index, corpus.Name, dimension)
+		}
+	}
+	log.Printf("Embedding model %s has %d dimensions", embedder.Model(), len(probe))
+	return nil
+}
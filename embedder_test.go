@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+// embeddingsServer answers /v1/embeddings with handler and records the
+// Authorization header and body of the last request
+func embeddingsServer(t *testing.T, handler func(w http.ResponseWriter, req OpenAIEmbeddingRequest)) (*httptest.Server, *http.Header) {
+	var header http.Header
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != "POST" || r.URL.Path != "/v1/embeddings" {
+			t.Errorf("request %s %s", r.Method, r.URL.Path)
+		}
+		header = r.Header.Clone()
+		var req OpenAIEmbeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("decoding embeddings request: %v", err)
+		}
+		handler(w, req)
+	}))
+	t.Cleanup(server.Close)
+	return server, &header
+}
+
+// embedLengths embeds each input as its length, answering in reverse order
+func embedLengths(w http.ResponseWriter, req OpenAIEmbeddingRequest) {
+	var response OpenAIEmbeddingResponse
+	response.Model = req.Model
+	for i := len(req.Input) - 1; i >= 0; i-- {
+		response.Data = append(response.Data, struct {
+			Embedding []float64 `json:"embedding"`
+			Index     int       `json:"index"`
+		}{[]float64{float64(len(req.Input[i]))}, i})
+		response.Usage.TotalTokens += len(req.Input[i])
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func TestOpenAIEmbeddingRequest(t *testing.T) {
+	var got OpenAIEmbeddingRequest
+	server, header := embeddingsServer(t, func(w http.ResponseWriter, req OpenAIEmbeddingRequest) {
+		got = req
+		embedLengths(w, req)
+	})
+	client := NewOpenAIEmbeddingClient("key", server.URL+"/v1/", "nomic-embed-text")
+
+	ctx, sink := withUsageSink(context.Background())
+	embeddings, err := client.GetEmbeddings(ctx, []string{"a", "bb", "ccc"}, "document")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(embeddings, [][]float64{{1}, {2}, {3}}) {
+		t.Errorf("embeddings %v, want them in input order", embeddings)
+	}
+	want := OpenAIEmbeddingRequest{Input: []string{"a", "bb", "ccc"}, Model: "nomic-embed-text"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("request %+v, want %+v", got, want)
+	}
+	if header.Get("Authorization") != "Bearer key" || header.Get("Content-Type") != "application/json" {
+		t.Errorf("headers %v", *header)
+	}
+	if sink.tokens != 6 {
+		t.Errorf("%d tokens reported, want 6", sink.tokens)
+	}
+}
+
+func TestOpenAIEmbeddingWithoutKey(t *testing.T) {
+	server, header := embeddingsServer(t, embedLengths)
+	client := NewOpenAIEmbeddingClient("", server.URL+"/v1", "local")
+	if _, err := client.GetEmbeddingWithType(context.Background(), "a", "query"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := (*header)["Authorization"]; ok {
+		t.Errorf("Authorization %q sent without a key", header.Get("Authorization"))
+	}
+}
+
+func TestOpenAIEmbeddingErrors(t *testing.T) {
+	useRetryPolicy(t, RetryPolicy{MaxAttempts: 1})
+	tests := []struct {
+		name    string
+		handler func(w http.ResponseWriter, req OpenAIEmbeddingRequest)
+		status  int
+	}{
+		{"bad request", func(w http.ResponseWriter, req OpenAIEmbeddingRequest) {
+			http.Error(w, "unknown model", http.StatusBadRequest)
+		}, http.StatusBadRequest},
+		{"overloaded", func(w http.ResponseWriter, req OpenAIEmbeddingRequest) {
+			http.Error(w, "try later", http.StatusServiceUnavailable)
+		}, http.StatusServiceUnavailable},
+		{"missing embeddings", func(w http.ResponseWriter, req OpenAIEmbeddingRequest) {
+			fmt.Fprint(w, `{"data": []}`)
+		}, 0},
+		{"invalid index", func(w http.ResponseWriter, req OpenAIEmbeddingRequest) {
+			fmt.Fprint(w, `{"data": [{"embedding": [1], "index": 5}]}`)
+		}, 0},
+	}
+	for _, tt := range tests {
+		server, _ := embeddingsServer(t, tt.handler)
+		client := NewOpenAIEmbeddingClient("key", server.URL+"/v1", "model")
+		_, err := client.GetEmbeddingWithType(context.Background(), "a", "query")
+		if err == nil {
+			t.Errorf("%s: no error", tt.name)
+			continue
+		}
+		var apiErr *APIError
+		if tt.status != 0 && (!errors.As(err, &apiErr) || apiErr.StatusCode != tt.status) {
+			t.Errorf("%s: error %v, want an API error with status %d", tt.name, err, tt.status)
+		}
+	}
+}
+
+// dimensionRegistry returns a registry of one corpus whose index reports
+// dimension, or answers with status when it isn't 200
+func dimensionRegistry(t *testing.T, status, dimension int) map[string]*Corpus {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/describe_index_stats" {
+			t.Errorf("request for %s", r.URL.Path)
+		}
+		if status != http.StatusOK {
+			http.Error(w, "unavailable", status)
+			return
+		}
+		fmt.Fprintf(w, `{"dimension": %d}`, dimension)
+	}))
+	t.Cleanup(server.Close)
+	return map[string]*Corpus{
+		corpusPosts: {Name: corpusPosts, Index: "test", client: NewPineconeClient("key", server.URL, "test")},
+	}
+}
+
+func TestCheckEmbeddingDimension(t *testing.T) {
+	useRetryPolicy(t, RetryPolicy{MaxAttempts: 1})
+	ctx := context.Background()
+	// fakeEmbedder embeds the probe as a single dimension
+	if err := checkEmbeddingDimension(ctx, &fakeEmbedder{}, dimensionRegistry(t, http.StatusOK, 1)); err != nil {
+		t.Errorf("matching dimension: %v", err)
+	}
+	if err := checkEmbeddingDimension(ctx, &fakeEmbedder{}, dimensionRegistry(t, http.StatusOK, 1024)); err == nil {
+		t.Error("a 1-dimension model passed the check of a 1024-dimension index")
+	}
+
+	// Upstreams that can't be reached are only logged
+	if err := checkEmbeddingDimension(ctx, &fakeEmbedder{}, dimensionRegistry(t, http.StatusServiceUnavailable, 0)); err != nil {
+		t.Errorf("index unavailable: %v", err)
+	}
+	unreachable := map[string]*Corpus{corpusPosts: {Name: corpusPosts, client: NewPineconeClient("key", "http://127.0.0.1:1", "test")}}
+	if err := checkEmbeddingDimension(ctx, &fakeEmbedder{}, unreachable); err != nil {
+		t.Errorf("index unreachable: %v", err)
+	}
+	failing := &fakeEmbedder{err: errors.New("connection refused")}
+	if err := checkEmbeddingDimension(ctx, failing, dimensionRegistry(t, http.StatusOK, 1024)); err != nil {
+		t.Errorf("embedder unreachable: %v", err)
+	}
+}
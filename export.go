@@ -4,34 +4,35 @@ import (
 	"bytes"
 	"encoding/csv"
 	"net/http"
-	"strings"
 	"time"
 )
 
 // handleOPMLExport exports search results as OPML
 func (app *App) handleOPMLExport(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("qry")
-	if query == "" {
-		http.Error(w, "Query parameter 'qry' is required", http.StatusBadRequest)
+	req, err := searchRequestFromHTTP(r)
+	if err != nil {
+		writeQueryError(w, err)
 		return
 	}
 
 	// Ensure this is a feeds search
-	if !strings.Contains(query, "type:feeds") {
-		query += " type:feeds"
-	}
+	req.Namespace = "feeds"
 
-	results, _ := app.performSearch(query, r.URL.Query())
+	response, err := app.performSearch(r.Context(), req)
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
 
 	// Filter only feed results
 	var feedResults []SearchResult
-	for _, result := range results {
+	for _, result := range response.Results {
 		if result.IsFeed {
 			feedResults = append(feedResults, result)
 		}
 	}
 
-	opmlContent := generateOPML(feedResults, query)
+	opmlContent := generateOPML(feedResults, req.Text)
 
 	w.Header().Set("Content-Type", "application/xml")
 	w.Header().Set("Content-Disposition", "attachment; filename=\"feeds.opml\"")
@@ -40,22 +41,24 @@ func (app *App) handleOPMLExport(w http.ResponseWriter, r *http.Request) {
 
 // handleCSVExport exports search results as CSV
 func (app *App) handleCSVExport(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("qry")
-	if query == "" {
-		http.Error(w, "Query parameter 'qry' is required", http.StatusBadRequest)
+	req, err := searchRequestFromHTTP(r)
+	if err != nil {
+		writeQueryError(w, err)
 		return
 	}
 
 	// Ensure this is a feeds search
-	if !strings.Contains(query, "type:feeds") {
-		query += " type:feeds"
-	}
+	req.Namespace = "feeds"
 
-	results, _ := app.performSearch(query, r.URL.Query())
+	response, err := app.performSearch(r.Context(), req)
+	if err != nil {
+		writeSearchError(w, err)
+		return
+	}
 
 	// Filter only feed results
 	var feedResults []SearchResult
-	for _, result := range results {
+	for _, result := range response.Results {
 		if result.IsFeed {
 			feedResults = append(feedResults, result)
 		}
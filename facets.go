@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// facetWindow is the minimum number of candidates retrieved when facets are
+// requested, so that counts describe the topic rather than the page
+const facetWindow = 500
+
+// maxFacetValues is the number of values listed for each facet
+const maxFacetValues = 10
+
+// Facet counts the candidates sharing each value of one field
+type Facet struct {
+	Name   string       `json:"name"`
+	Label  string       `json:"label"`
+	Values []FacetCount `json:"values"`
+}
+
+// FacetCount is one facet value. Refine is the query operator that narrows
+// the search to it.
+type FacetCount struct {
+	Value  string `json:"value"`
+	Count  int    `json:"count"`
+	Refine string `json:"refine"`
+}
+
+// facetDefinition describes how a facet is read from a result
+type facetDefinition struct {
+	name     string
+	label    string
+	operator string
+	// values returns the raw values of a result and how each is displayed
+	values func(r *SearchResult) []facetValue
+}
+
+// facetValue is a raw value, as matched by the operator, and its display text
+type facetValue struct {
+	raw     string
+	display string
+}
+
+// facetDefinitions lists the facets in display order
+var facetDefinitions = []facetDefinition{
+	{name: "domain", label: "Site", operator: "site", values: func(r *SearchResult) []facetValue {
+		if r.OriginalDomain == "" {
+			return nil
+		}
+		return []facetValue{{raw: r.OriginalDomain, display: getStringDefault(r.BaseDomain, r.OriginalDomain)}}
+	}},
+	{name: "lang", label: "Language", operator: "lang", values: metadataFacetValues(func(f CorpusFields) string { return f.Lang })},
+	{name: "rsstype", label: "Content", operator: "type", values: metadataFacetValues(func(f CorpusFields) string { return f.ContentType })},
+	{name: "site_type", label: "Site type", operator: "sype", values: metadataFacetValues(func(f CorpusFields) string { return f.SiteType })},
+	{name: "owner_type", label: "Owner", operator: "oype", values: metadataFacetValues(func(f CorpusFields) string { return f.OwnerType })},
+	{name: "month", label: "Published", operator: "between", values: func(r *SearchResult) []facetValue {
+		published := r.publishedTime()
+		if published.IsZero() {
+			return nil
+		}
+		month := published.UTC().Format("2006-01")
+		return []facetValue{{raw: month + ".." + month, display: month}}
+	}},
+}
+
+// metadataFacetValues reads a string or list of strings from result
+// metadata, using the field name of the result's corpus
+func metadataFacetValues(field func(f CorpusFields) string) func(r *SearchResult) []facetValue {
+	return func(r *SearchResult) []facetValue {
+		key := field(corpusFor(r.IsFeed).Fields)
+		if key == "" {
+			return nil
+		}
+		var values []facetValue
+		for _, v := range toInterfaceSlice(r.metadata[key]) {
+			if s, ok := v.(string); ok && s != "" {
+				values = append(values, facetValue{raw: s, display: s})
+			}
+		}
+		return values
+	}
+}
+
+// computeFacets counts the values of each facet over results. Facets with no
+// values are left out.
+func computeFacets(results []SearchResult) []Facet {
+	var facets []Facet
+	for _, def := range facetDefinitions {
+		counts := make(map[facetValue]int)
+		for i := range results {
+			for _, value := range def.values(&results[i]) {
+				counts[value]++
+			}
+		}
+		if len(counts) == 0 {
+			continue
+		}
+
+		facet := Facet{Name: def.name, Label: def.label}
+		for value, count := range counts {
+			facet.Values = append(facet.Values, FacetCount{
+				Value:  value.display,
+				Count:  count,
+				Refine: facetOperator(def.operator, value.raw),
+			})
+		}
+		sort.Slice(facet.Values, func(i, j int) bool {
+			a, b := facet.Values[i], facet.Values[j]
+			if a.Count != b.Count {
+				return a.Count > b.Count
+			}
+			return a.Value < b.Value
+		})
+		if len(facet.Values) > maxFacetValues {
+			facet.Values = facet.Values[:maxFacetValues]
+		}
+		facets = append(facets, facet)
+	}
+	return facets
+}
+
+// facetOperator writes name:value, quoting values the lexer would split
+func facetOperator(name, value string) string {
+	if strings.ContainsAny(value, " \t()") {
+		return fmt.Sprintf(`%s:"%s"`, name, value)
+	}
+	return name + ":" + value
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// facetByName returns the facet called name, or nil
+func facetByName(facets []Facet, name string) *Facet {
+	for i := range facets {
+		if facets[i].Name == name {
+			return &facets[i]
+		}
+	}
+	return nil
+}
+
+func TestComputeFacets(t *testing.T) {
+	post := func(domain string, published time.Time, lang string, types ...string) SearchResult {
+		return SearchResult{
+			OriginalDomain: "https://" + domain,
+			BaseDomain:     domain,
+			published:      published,
+			metadata:       map[string]interface{}{"lang": lang, "rsstype": types},
+		}
+	}
+	// Late on 31 March in UTC-2 is already April in UTC
+	lateMarch := time.Date(2024, 3, 31, 23, 30, 0, 0, time.FixedZone("UTC-2", -2*60*60))
+	results := []SearchResult{
+		post("a.com", time.Date(2024, 3, 2, 0, 0, 0, 0, time.UTC), "en", "blog"),
+		post("a.com", lateMarch, "en", "blog", "news"),
+		post("b.com", time.Date(2024, 3, 15, 0, 0, 0, 0, time.UTC), "de", "news"),
+		{OriginalDomain: "https://c.com", Date: "2024-03-20"},
+	}
+	facets := computeFacets(results)
+
+	var names []string
+	for _, facet := range facets {
+		names = append(names, facet.Name)
+	}
+	if want := []string{"domain", "lang", "rsstype", "month"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("facets %v, want %v without the empty ones", names, want)
+	}
+
+	domain := facetByName(facets, "domain")
+	wantDomains := []FacetCount{
+		{Value: "a.com", Count: 2, Refine: "site:https://a.com"},
+		{Value: "b.com", Count: 1, Refine: "site:https://b.com"},
+		{Value: "https://c.com", Count: 1, Refine: "site:https://c.com"},
+	}
+	if !reflect.DeepEqual(domain.Values, wantDomains) {
+		t.Errorf("domain values %+v", domain.Values)
+	}
+
+	// Each value of a list counts once, and ties are listed alphabetically
+	rsstype := facetByName(facets, "rsstype")
+	wantTypes := []FacetCount{
+		{Value: "blog", Count: 2, Refine: "type:blog"},
+		{Value: "news", Count: 2, Refine: "type:news"},
+	}
+	if !reflect.DeepEqual(rsstype.Values, wantTypes) {
+		t.Errorf("rsstype values %+v", rsstype.Values)
+	}
+
+	month := facetByName(facets, "month")
+	wantMonths := []FacetCount{
+		{Value: "2024-03", Count: 3, Refine: "between:2024-03..2024-03"},
+		{Value: "2024-04", Count: 1, Refine: "between:2024-04..2024-04"},
+	}
+	if !reflect.DeepEqual(month.Values, wantMonths) {
+		t.Errorf("month values %+v, want %+v", month.Values, wantMonths)
+	}
+}
+
+func TestComputeFacetsCapsValues(t *testing.T) {
+	var results []SearchResult
+	for i := 0; i < maxFacetValues+5; i++ {
+		// Site i appears i+1 times
+		for j := 0; j <= i; j++ {
+			results = append(results, SearchResult{OriginalDomain: "site" + strconv.Itoa(i)})
+		}
+	}
+	domain := facetByName(computeFacets(results), "domain")
+	if len(domain.Values) != maxFacetValues {
+		t.Fatalf("%d domain values, want %d", len(domain.Values), maxFacetValues)
+	}
+	if first := domain.Values[0]; first.Value != "site14" || first.Count != 15 {
+		t.Errorf("first value %+v, want the most common", first)
+	}
+}
+
+func TestFacetOperator(t *testing.T) {
+	tests := []struct {
+		value, want string
+	}{
+		{"blog", "site:blog"},
+		{"https://example.com", "site:https://example.com"},
+		{"Example Blog", `site:"Example Blog"`},
+		{"tab\there", "site:\"tab\there\""},
+		{"Go (language)", `site:"Go (language)"`},
+		{"a:b c", `site:"a:b c"`},
+	}
+	for _, tt := range tests {
+		got := facetOperator("site", tt.value)
+		if got != tt.want {
+			t.Errorf("facetOperator(%q) = %s, want %s", tt.value, got, tt.want)
+		}
+
+		// The operator lexes back to the value it refines to
+		tokens, err := lexQuery(got)
+		if err != nil || len(tokens) != 2 || tokens[0].kind != tokenOperator || tokens[0].value != tt.value {
+			t.Errorf("%s lexes to %+v, %v", got, tokens, err)
+		}
+	}
+}
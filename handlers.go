@@ -2,7 +2,10 @@ package main
 
 import (
 	"encoding/json"
+	"errors"
+	"log"
 	"net/http"
+	"strconv"
 )
 
 // handleHome renders the homepage with search form
@@ -35,47 +38,116 @@ func (app *App) handleHome(w http.ResponseWriter, r *http.Request) {
 
 // handleSearch handles the main search functionality with HTML response
 func (app *App) handleSearch(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("qry")
-	if query == "" {
+	req := searchRequestFromParams(r.URL.Query())
+	// Facets widen retrieval, so they are only counted for the first page
+	req.Facets = req.Cursor == ""
+	if req.Text == "" {
 		// Default search
-		query = "ai, software development, startups, tech, data, computers since:last_3days length:1000 type:blog score:0.6 lang:en"
+		req.Text = "ai, software development, startups, tech, data, computers since:last_3days length:1000 type:blog score:0.6 lang:en"
 	}
 
-	results, timeTaken := app.performSearch(query, r.URL.Query())
+	response, searchErr := app.performSearch(r.Context(), req)
+
+	// Show a banner rather than "no results" when an upstream failed
+	var queryErrs QueryErrors
+	errors.As(searchErr, &queryErrs)
+	unavailable := isUpstreamFailure(searchErr)
 
 	data := map[string]interface{}{
 		"Query":        r.URL.Query().Get("qry"),
 		"SearchType":   getStringDefault(r.URL.Query().Get("type"), "pages"),
 		"SearchContent": r.URL.Query().Get("content"),
 		"SearchTime":   r.URL.Query().Get("time"),
-		"Results":      results,
-		"TimeTaken":    timeTaken,
-		"TotalResults": len(results),
+		"Results":      response.Results,
+		"TimeTaken":    response.TimeTaken,
+		"TotalResults": response.TotalResults,
+		"Facets":       response.Facets,
+		"Clusters":     response.Clusters,
+		"QueryErrors":  queryErrs,
+		"Unavailable":  unavailable,
+		"PrevURL":      pageURL(r.URL, response.PrevCursor),
+		"NextURL":      pageURL(r.URL, response.NextCursor),
 	}
 
 	w.Header().Set("Content-Type", "text/html")
+	if unavailable {
+		log.Printf("Search unavailable: %v", searchErr)
+		w.Header().Set("Retry-After", strconv.Itoa(upstreamRetryAfter))
+		w.WriteHeader(http.StatusServiceUnavailable)
+	} else if queryErrs != nil {
+		w.WriteHeader(http.StatusBadRequest)
+	} else if searchErr != nil {
+		log.Printf("Search failed: %v", searchErr)
+		w.WriteHeader(http.StatusInternalServerError)
+	}
 	err := app.templates.ExecuteTemplate(w, "index.html", data)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 	}
 }
 
-// handleAPISearch handles search requests with JSON response
+// handleAPISearch handles search requests with JSON response. The search is
+// described by URL parameters, or by a JSON SearchRequest in a POST body.
 func (app *App) handleAPISearch(w http.ResponseWriter, r *http.Request) {
-	query := r.URL.Query().Get("qry")
-	if query == "" {
-		http.Error(w, "Query parameter 'qry' is required", http.StatusBadRequest)
+	req, err := searchRequestFromHTTP(r)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	response, err := app.performSearch(r.Context(), req)
+	if err != nil {
+		writeSearchError(w, err)
 		return
 	}
 
-	results, timeTaken := app.performSearch(query, r.URL.Query())
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleAPITrend handles topic trend requests with a JSON response
+func (app *App) handleAPITrend(w http.ResponseWriter, r *http.Request) {
+	response, err := app.performTrend(r.Context(), trendRequestFromParams(r.URL.Query()))
+	if err != nil {
+		log.Printf("Trend error: %v", err)
+		writeSearchError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(response)
+}
+
+// handleEmbeddingCacheStats reports the embedding cache's hit and miss counts
+func (app *App) handleEmbeddingCacheStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(app.embedCache.Stats())
+}
+
+// handleRetryStats reports the requests and retries made to each upstream
+// service
+func (app *App) handleRetryStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(retryStatsByService())
+}
+
+// handleUsageReport reports embedding tokens per day and request path, and
+// whether the daily budget has switched embedding to cached-only
+func (app *App) handleUsageReport(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(app.usage.Report())
+}
 
-	response := SearchResponse{
-		Results:      results,
-		TimeTaken:    timeTaken,
-		TotalResults: len(results),
+// writeQueryError writes a 400 JSON body listing every problem in a query
+func writeQueryError(w http.ResponseWriter, err error) {
+	response := QueryErrorResponse{Error: err.Error()}
+	var queryErrs QueryErrors
+	if errors.As(err, &queryErrs) {
+		response.Error = "invalid query"
+		response.Errors = queryErrs
 	}
 
 	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
 	json.NewEncoder(w).Encode(response)
 }
\ No newline at end of file
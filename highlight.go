@@ -0,0 +1,225 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxSnippetLength is the longest snippet, in characters, cut from a subtitle
+const maxSnippetLength = 220
+
+// ResultHighlights holds the title and a snippet of a result with query
+// terms wrapped in <mark>. All other text is HTML escaped, so the markup is
+// safe to insert into a page.
+type ResultHighlights struct {
+	Title   template.HTML `json:"title"`
+	Snippet template.HTML `json:"snippet"`
+}
+
+// highlightSynonyms maps terms to close equivalents that are also marked
+var highlightSynonyms = map[string][]string{
+	"js":         {"javascript"},
+	"javascript": {"js"},
+	"ts":         {"typescript"},
+	"typescript": {"ts"},
+	"go":         {"golang"},
+	"golang":     {"go"},
+	"k8s":        {"kubernetes"},
+	"kubernetes": {"k8s"},
+	"postgres":   {"postgresql"},
+	"postgresql": {"postgres"},
+	"db":         {"database"},
+	"database":   {"db"},
+	"ai":         {"llm", "ml"},
+	"llm":        {"ai"},
+	"ml":         {"ai"},
+	"py":         {"python"},
+	"python":     {"py"},
+	"repo":       {"repository"},
+	"repository": {"repo"},
+	"auth":       {"authentication", "authorization"},
+}
+
+// highlighter marks the words of a query, their synonyms and simple
+// inflections in result text
+type highlighter struct {
+	stems map[string]bool
+}
+
+// newHighlighter builds a highlighter for the query text. Stopwords are
+// ignored unless the query has nothing else.
+func newHighlighter(text string) *highlighter {
+	terms := tokenize(text)
+	var kept []string
+	for _, term := range terms {
+		if !stopwords[term] {
+			kept = append(kept, term)
+		}
+	}
+	if len(kept) == 0 {
+		kept = terms
+	}
+
+	h := &highlighter{stems: make(map[string]bool)}
+	for _, term := range kept {
+		h.stems[stemTerm(term)] = true
+		var synonyms []string
+		synonyms = append(synonyms, highlightSynonyms[term]...)
+		synonyms = append(synonyms, highlightSynonyms[stemTerm(term)]...)
+		for _, synonym := range synonyms {
+			h.stems[stemTerm(synonym)] = true
+		}
+	}
+	return h
+}
+
+// highlight returns the highlighted title and snippet for a result
+func (h *highlighter) highlight(r *SearchResult) *ResultHighlights {
+	title := markSpans(r.Title, h.matches(r.Title))
+
+	subtitleMatches := h.matches(r.Subtitle)
+	start, end := selectSnippet(r.Subtitle, subtitleMatches)
+	var window [][2]int
+	for _, m := range subtitleMatches {
+		if m[0] >= start && m[1] <= end {
+			window = append(window, [2]int{m[0] - start, m[1] - start})
+		}
+	}
+	snippet := markSpans(r.Subtitle[start:end], window)
+	if start > 0 {
+		snippet = "…" + snippet
+	}
+	if end < len(r.Subtitle) {
+		snippet += "…"
+	}
+
+	return &ResultHighlights{Title: template.HTML(title), Snippet: template.HTML(snippet)}
+}
+
+// matches returns the byte spans of the words in text that match the query
+func (h *highlighter) matches(text string) [][2]int {
+	var spans [][2]int
+	for _, span := range wordSpans(text) {
+		if h.stems[stemTerm(strings.ToLower(text[span[0]:span[1]]))] {
+			spans = append(spans, span)
+		}
+	}
+	return spans
+}
+
+// markSpans escapes text and wraps each span in <mark>
+func markSpans(text string, spans [][2]int) string {
+	var b strings.Builder
+	pos := 0
+	for _, span := range spans {
+		b.WriteString(html.EscapeString(text[pos:span[0]]))
+		b.WriteString("<mark>")
+		b.WriteString(html.EscapeString(text[span[0]:span[1]]))
+		b.WriteString("</mark>")
+		pos = span[1]
+	}
+	b.WriteString(html.EscapeString(text[pos:]))
+	return b.String()
+}
+
+// selectSnippet picks the byte range of text, at most maxSnippetLength
+// characters long, that contains the most matches. Each candidate range
+// starts a little before a match, on a word boundary.
+func selectSnippet(text string, matches [][2]int) (int, int) {
+	if utf8.RuneCountInString(text) <= maxSnippetLength {
+		return 0, len(text)
+	}
+
+	words := wordSpans(text)
+	bestStart, bestCount := 0, 0
+	for _, match := range matches {
+		// Back up a quarter of a snippet, then forward to a word start
+		lead := match[0]
+		for n := 0; lead > 0 && n < maxSnippetLength/4; n++ {
+			_, size := utf8.DecodeLastRuneInString(text[:lead])
+			lead -= size
+		}
+		start := match[0]
+		for _, word := range words {
+			if word[0] >= lead {
+				start = word[0]
+				break
+			}
+		}
+
+		end := snippetEnd(text, start)
+		count := 0
+		for _, m := range matches {
+			if m[0] >= start && m[1] <= end {
+				count++
+			}
+		}
+		if count > bestCount {
+			bestStart, bestCount = start, count
+		}
+	}
+
+	// Start at the beginning when the best range is near it anyway
+	if utf8.RuneCountInString(text[:bestStart]) < maxSnippetLength/4 {
+		bestStart = 0
+	}
+	return bestStart, snippetEnd(text, bestStart)
+}
+
+// snippetEnd returns the end of a snippet starting at start, cut back to the
+// end of the last whole word
+func snippetEnd(text string, start int) int {
+	end, n := start, 0
+	for end < len(text) && n < maxSnippetLength {
+		_, size := utf8.DecodeRuneInString(text[end:])
+		end += size
+		n++
+	}
+	if end >= len(text) {
+		return len(text)
+	}
+	cut := strings.LastIndexFunc(text[start:end], unicode.IsSpace)
+	if cut <= 0 {
+		return end
+	}
+	return start + cut
+}
+
+// wordSpans returns the byte spans of the letter and digit runs in text,
+// matching the words produced by tokenize
+func wordSpans(text string) [][2]int {
+	var spans [][2]int
+	start := -1
+	for i, r := range text {
+		isWord := unicode.IsLetter(r) || unicode.IsDigit(r)
+		if isWord && start < 0 {
+			start = i
+		} else if !isWord && start >= 0 {
+			spans = append(spans, [2]int{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, [2]int{start, len(text)})
+	}
+	return spans
+}
+
+// stemTerm strips common English inflections so that plurals and verb
+// forms of a query term are also marked
+func stemTerm(term string) string {
+	switch {
+	case len(term) > 4 && strings.HasSuffix(term, "ies"):
+		return term[:len(term)-3] + "y"
+	case len(term) > 5 && strings.HasSuffix(term, "ing"):
+		return term[:len(term)-3]
+	case len(term) > 4 && strings.HasSuffix(term, "ed"):
+		return term[:len(term)-2]
+	case len(term) > 3 && strings.HasSuffix(term, "s") && !strings.HasSuffix(term, "ss"):
+		return term[:len(term)-1]
+	}
+	return term
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+// onlyMarkTags reports whether <mark> and </mark> are the only tags in s
+func onlyMarkTags(s string) bool {
+	s = strings.ReplaceAll(s, "<mark>", "")
+	s = strings.ReplaceAll(s, "</mark>", "")
+	return !strings.ContainsAny(s, "<>")
+}
+
+func TestHighlightEscapes(t *testing.T) {
+	h := newHighlighter("script go")
+	result := &SearchResult{
+		Title:    `<script>alert("go")</script> & Go's 'tips'`,
+		Subtitle: `<img src=x onerror="alert(1)"> scripts & <b>more</b>`,
+	}
+	got := h.highlight(result)
+
+	wantTitle := `&lt;<mark>script</mark>&gt;alert(&#34;<mark>go</mark>&#34;)&lt;/<mark>script</mark>&gt; &amp; <mark>Go</mark>&#39;s &#39;tips&#39;`
+	if string(got.Title) != wantTitle {
+		t.Errorf("title\n got %s\nwant %s", got.Title, wantTitle)
+	}
+	wantSnippet := `&lt;img src=x onerror=&#34;alert(1)&#34;&gt; <mark>scripts</mark> &amp; &lt;b&gt;more&lt;/b&gt;`
+	if string(got.Snippet) != wantSnippet {
+		t.Errorf("snippet\n got %s\nwant %s", got.Snippet, wantSnippet)
+	}
+	for _, field := range []string{string(got.Title), string(got.Snippet)} {
+		if !onlyMarkTags(field) {
+			t.Errorf("%s emits a tag other than <mark>", field)
+		}
+	}
+}
+
+func TestHighlightMultibyte(t *testing.T) {
+	h := newHighlighter("café")
+	got := markSpans("naïve café crème", h.matches("naïve café crème"))
+	if want := "naïve <mark>café</mark> crème"; got != want {
+		t.Errorf("markSpans = %q, want %q", got, want)
+	}
+
+	// A long subtitle of two-byte runes is cut on rune boundaries
+	subtitle := strings.Repeat("éé ", 100) + "café " + strings.Repeat("éé ", 100)
+	snippet := string(h.highlight(&SearchResult{Subtitle: subtitle}).Snippet)
+	if !utf8.ValidString(snippet) {
+		t.Fatalf("snippet %q is not valid UTF-8", snippet)
+	}
+	if !strings.Contains(snippet, "<mark>café</mark>") {
+		t.Errorf("snippet %q doesn't mark café", snippet)
+	}
+	text := strings.Trim(strings.NewReplacer("<mark>", "", "</mark>", "").Replace(snippet), "…")
+	if n := utf8.RuneCountInString(text); n > maxSnippetLength {
+		t.Errorf("snippet has %d characters, want at most %d", n, maxSnippetLength)
+	}
+}
+
+func TestHighlightStemsAndSynonyms(t *testing.T) {
+	h := newHighlighter("the libraries for golang testing")
+	text := "A library of Go tests, tested and the best"
+	got := markSpans(text, h.matches(text))
+	want := "A <mark>library</mark> of <mark>Go</mark> <mark>tests</mark>, <mark>tested</mark> and the best"
+	if got != want {
+		t.Errorf("markSpans\n got %s\nwant %s", got, want)
+	}
+
+	// Stopwords are only marked when the query has nothing else
+	if h := newHighlighter("the"); !h.stems["the"] {
+		t.Error("a query of stopwords marks nothing")
+	}
+}
+
+func TestStemTerm(t *testing.T) {
+	tests := map[string]string{
+		"libraries": "library",
+		"testing":   "test",
+		"tested":    "test",
+		"tests":     "test",
+		"class":     "class",
+		"ring":      "ring",
+		"bed":       "bed",
+		"go":        "go",
+	}
+	for term, want := range tests {
+		if got := stemTerm(term); got != want {
+			t.Errorf("stemTerm(%q) = %q, want %q", term, got, want)
+		}
+	}
+}
+
+func TestSelectSnippetDensestMatch(t *testing.T) {
+	filler := strings.Repeat("lorem ipsum ", 30)
+	subtitle := "rust " + filler + "rust and rust with rust " + filler
+	h := newHighlighter("rust")
+	snippet := string(h.highlight(&SearchResult{Subtitle: subtitle}).Snippet)
+
+	if !strings.HasPrefix(snippet, "…") || !strings.HasSuffix(snippet, "…") {
+		t.Errorf("snippet %q should be cut at both ends", snippet)
+	}
+	if n := strings.Count(snippet, "<mark>rust</mark>"); n != 3 {
+		t.Errorf("snippet marks %d matches, want the 3 close together: %q", n, snippet)
+	}
+
+	// Short text is kept whole
+	if start, end := selectSnippet("short rust text", h.matches("short rust text")); start != 0 || end != len("short rust text") {
+		t.Errorf("selectSnippet of short text = %d, %d", start, end)
+	}
+}
@@ -0,0 +1,282 @@
+package main
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+// Retrieval modes selected with mode:
+const (
+	searchModeVector  = "vector"
+	searchModeLexical = "lexical"
+	searchModeHybrid  = "hybrid"
+)
+
+// isSearchMode reports whether value names a retrieval mode
+func isSearchMode(value string) bool {
+	return value == searchModeVector || value == searchModeLexical || value == searchModeHybrid
+}
+
+// BM25 parameters and index limits
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+	// lexicalTitleWeight counts title terms more than subtitle terms
+	lexicalTitleWeight = 2
+	// maxLexicalDocs bounds each corpus; the oldest documents are evicted
+	maxLexicalDocs = 100000
+)
+
+// lexicalIndex is an in-process BM25 index over the titles and subtitles of
+// every match Pinecone has returned. Vector search misses exact names such
+// as libraries and people, so lexical hits are fused with vector results.
+type lexicalIndex struct {
+	mu      sync.RWMutex
+	corpora map[string]*lexicalCorpus // by corpus name
+}
+
+// lexicalCorpus holds the documents and postings for one corpus
+type lexicalCorpus struct {
+	docs        map[string]*lexicalDoc
+	postings    map[string]map[string]int // term -> doc ID -> weighted frequency
+	order       []lexicalEntry            // insertions, oldest first
+	seq         int
+	totalLength int
+}
+
+// lexicalEntry records when a document was inserted. Entries for documents
+// that have since been replaced are skipped during eviction.
+type lexicalEntry struct {
+	id  string
+	seq int
+}
+
+// lexicalDoc is an indexed match with its weighted term frequencies
+type lexicalDoc struct {
+	match  PineconeMatch
+	terms  map[string]int
+	length int
+	seq    int
+}
+
+// newLexicalIndex creates an empty lexical index
+func newLexicalIndex() *lexicalIndex {
+	return &lexicalIndex{corpora: make(map[string]*lexicalCorpus)}
+}
+
+// add indexes matches returned from a corpus, replacing any earlier copy of
+// the same document
+func (idx *lexicalIndex) add(source *Corpus, matches []PineconeMatch) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+
+	corpus := idx.corpora[source.Name]
+	if corpus == nil {
+		corpus = &lexicalCorpus{
+			docs:     make(map[string]*lexicalDoc),
+			postings: make(map[string]map[string]int),
+		}
+		idx.corpora[source.Name] = corpus
+	}
+
+	for _, match := range matches {
+		title, subtitle := lexicalFields(match.Metadata, source)
+		doc := &lexicalDoc{
+			// Vectors aren't needed to rank or filter lexical hits
+			match: PineconeMatch{ID: match.ID, Metadata: match.Metadata},
+			terms: make(map[string]int),
+		}
+		for _, term := range tokenize(title) {
+			doc.terms[term] += lexicalTitleWeight
+			doc.length += lexicalTitleWeight
+		}
+		for _, term := range tokenize(subtitle) {
+			doc.terms[term]++
+			doc.length++
+		}
+		if doc.length == 0 {
+			continue
+		}
+		corpus.remove(match.ID)
+		corpus.insert(doc)
+	}
+
+	corpus.evict(maxLexicalDocs)
+}
+
+// insert adds a document that isn't already in the corpus
+func (c *lexicalCorpus) insert(doc *lexicalDoc) {
+	id := doc.match.ID
+	c.seq++
+	doc.seq = c.seq
+	c.docs[id] = doc
+	c.order = append(c.order, lexicalEntry{id: id, seq: doc.seq})
+	c.totalLength += doc.length
+	for term, freq := range doc.terms {
+		if c.postings[term] == nil {
+			c.postings[term] = make(map[string]int)
+		}
+		c.postings[term][id] = freq
+	}
+}
+
+// remove deletes a document from the corpus if present
+func (c *lexicalCorpus) remove(id string) {
+	doc, ok := c.docs[id]
+	if !ok {
+		return
+	}
+	delete(c.docs, id)
+	c.totalLength -= doc.length
+	for term := range doc.terms {
+		delete(c.postings[term], id)
+		if len(c.postings[term]) == 0 {
+			delete(c.postings, term)
+		}
+	}
+}
+
+// evict removes the oldest documents until at most limit remain
+func (c *lexicalCorpus) evict(limit int) {
+	for len(c.docs) > limit && len(c.order) > 0 {
+		entry := c.order[0]
+		c.order = c.order[1:]
+		if doc, ok := c.docs[entry.id]; ok && doc.seq == entry.seq {
+			c.remove(entry.id)
+		}
+	}
+
+	// Drop entries left behind by replaced documents
+	if len(c.order) > 2*len(c.docs) {
+		live := make([]lexicalEntry, 0, len(c.docs))
+		for _, entry := range c.order {
+			if doc, ok := c.docs[entry.id]; ok && doc.seq == entry.seq {
+				live = append(live, entry)
+			}
+		}
+		c.order = live
+	}
+}
+
+// search ranks the documents in a corpus against the query text using
+// BM25. Only documents matching the metadata filter and containing every
+// phrase are returned. Scores are scaled so that the best hit scores 1.
+func (idx *lexicalIndex) search(source *Corpus, sq SearchQuery, topK int) []PineconeMatch {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	corpus := idx.corpora[source.Name]
+	terms := tokenize(sq.Text)
+	if corpus == nil || len(corpus.docs) == 0 || len(terms) == 0 {
+		return nil
+	}
+
+	n := float64(len(corpus.docs))
+	avgLength := float64(corpus.totalLength) / n
+	scores := make(map[string]float64)
+	seen := make(map[string]bool)
+	for _, term := range terms {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		postings := corpus.postings[term]
+		df := float64(len(postings))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, freq := range postings {
+			tf := float64(freq)
+			norm := bm25K1 * (1 - bm25B + bm25B*float64(corpus.docs[id].length)/avgLength)
+			scores[id] += idf * tf * (bm25K1 + 1) / (tf + norm)
+		}
+	}
+
+	var hits []PineconeMatch
+	for id, score := range scores {
+		doc := corpus.docs[id]
+		if !matchesFilter(doc.match.Metadata, sq.Filters) || !containsPhrases(doc.match.Metadata, sq.Phrases, source) {
+			continue
+		}
+		hit := doc.match
+		hit.Score = score
+		hits = append(hits, hit)
+	}
+
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	if len(hits) > topK {
+		hits = hits[:topK]
+	}
+	if len(hits) > 0 {
+		best := hits[0].Score
+		for i := range hits {
+			hits[i].Score /= best
+		}
+	}
+	return hits
+}
+
+// lexicalFields returns the title and subtitle shown for a match
+func lexicalFields(metadata map[string]interface{}, corpus *Corpus) (string, string) {
+	return corpus.title(metadata), corpus.field(metadata, corpus.Fields.Subtitle)
+}
+
+// containsPhrases reports whether the title or subtitle contains every phrase
+func containsPhrases(metadata map[string]interface{}, phrases []string, corpus *Corpus) bool {
+	if len(phrases) == 0 {
+		return true
+	}
+	title, subtitle := lexicalFields(metadata, corpus)
+	text := strings.Join(tokenize(title+" "+subtitle), " ")
+	for _, phrase := range phrases {
+		if !strings.Contains(" "+text+" ", " "+strings.Join(tokenize(phrase), " ")+" ") {
+			return false
+		}
+	}
+	return true
+}
+
+// tokenize lowercases text and splits it into letter and digit runs
+func tokenize(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+// rrfK dampens the advantage of top ranks in reciprocal rank fusion
+const rrfK = 60
+
+// fuseRankings merges ranked lists with reciprocal rank fusion, scoring each
+// match by the sum of 1/(rrfK+rank) over the lists it appears in. Scores are
+// scaled so that a match ranked first in every list scores 1.
+func fuseRankings(lists ...[]PineconeMatch) []PineconeMatch {
+	scores := make(map[string]float64)
+	matches := make(map[string]PineconeMatch)
+	var order []string
+	for _, list := range lists {
+		for rank, match := range list {
+			if _, ok := matches[match.ID]; !ok {
+				matches[match.ID] = match
+				order = append(order, match.ID)
+			}
+			scores[match.ID] += 1 / float64(rrfK+rank+1)
+		}
+	}
+
+	maxScore := float64(len(lists)) / float64(rrfK+1)
+	fused := make([]PineconeMatch, len(order))
+	for i, id := range order {
+		fused[i] = matches[id]
+		fused[i].Score = scores[id] / maxScore
+	}
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].Score > fused[j].Score
+	})
+	return fused
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+var testLexicalCorpus = &Corpus{
+	Name:   "test",
+	Fields: CorpusFields{Title: []string{"title"}, Subtitle: "subtitle", Lang: "lang"},
+}
+
+func lexicalMatch(id, title, subtitle, lang string) PineconeMatch {
+	return PineconeMatch{ID: id, Metadata: map[string]interface{}{
+		"title": title, "subtitle": subtitle, "lang": lang,
+	}}
+}
+
+func matchIDs(matches []PineconeMatch) []string {
+	ids := make([]string, len(matches))
+	for i, match := range matches {
+		ids[i] = match.ID
+	}
+	return ids
+}
+
+func TestLexicalSearch(t *testing.T) {
+	idx := newLexicalIndex()
+	idx.add(testLexicalCorpus, []PineconeMatch{
+		lexicalMatch("a", "Tokio internals", "How the tokio runtime schedules tasks", "en"),
+		lexicalMatch("b", "Async Rust", "A look at tokio and async-std", "en"),
+		lexicalMatch("c", "Kochen mit Tokio", "", "de"),
+		lexicalMatch("d", "Gardening", "Tomatoes in June", "en"),
+	})
+
+	hits := idx.search(testLexicalCorpus, SearchQuery{Text: "tokio"}, 10)
+	if ids := matchIDs(hits); len(ids) != 3 || ids[0] == "b" {
+		t.Fatalf("tokio: hits %v, want a and c ranked above b", ids)
+	}
+	if hits[0].Score != 1 {
+		t.Errorf("best hit scores %v, want 1", hits[0].Score)
+	}
+
+	filtered := idx.search(testLexicalCorpus, SearchQuery{
+		Text:    "tokio",
+		Filters: map[string]interface{}{"lang": map[string]interface{}{"$eq": "en"}},
+	}, 10)
+	if ids := matchIDs(filtered); len(ids) != 2 || ids[0] != "a" {
+		t.Errorf("tokio lang:en: hits %v", ids)
+	}
+
+	phrase := idx.search(testLexicalCorpus, SearchQuery{Text: "tokio runtime", Phrases: []string{"tokio runtime"}}, 10)
+	if ids := matchIDs(phrase); !reflect.DeepEqual(ids, []string{"a"}) {
+		t.Errorf("\"tokio runtime\": hits %v", ids)
+	}
+
+	if top := idx.search(testLexicalCorpus, SearchQuery{Text: "tokio"}, 1); len(top) != 1 {
+		t.Errorf("topK 1: %d hits", len(top))
+	}
+	if none := idx.search(testLexicalCorpus, SearchQuery{Text: "zig"}, 10); len(none) != 0 {
+		t.Errorf("zig: hits %v", matchIDs(none))
+	}
+}
+
+func TestLexicalReplaceAndEvict(t *testing.T) {
+	idx := newLexicalIndex()
+	idx.add(testLexicalCorpus, []PineconeMatch{lexicalMatch("a", "Old title", "", "en")})
+	idx.add(testLexicalCorpus, []PineconeMatch{lexicalMatch("a", "New title", "", "en")})
+
+	if hits := idx.search(testLexicalCorpus, SearchQuery{Text: "old"}, 10); len(hits) != 0 {
+		t.Errorf("replaced document still found by its old title")
+	}
+	if hits := idx.search(testLexicalCorpus, SearchQuery{Text: "new"}, 10); len(hits) != 1 {
+		t.Errorf("replaced document not found by its new title")
+	}
+
+	corpus := idx.corpora[testLexicalCorpus.Name]
+	for _, id := range []string{"b", "c", "d"} {
+		idx.add(testLexicalCorpus, []PineconeMatch{lexicalMatch(id, "Title "+id, "", "en")})
+	}
+	corpus.evict(2)
+	if len(corpus.docs) != 2 || corpus.docs["a"] != nil || corpus.docs["b"] != nil {
+		t.Errorf("evict kept %d docs, want the newest two", len(corpus.docs))
+	}
+	if len(corpus.postings["new"]) != 0 {
+		t.Errorf("evicted document left postings behind")
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	got := tokenize("Go 1.22: What's new in net/http?")
+	want := []string{"go", "1", "22", "what", "s", "new", "in", "net", "http"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("tokenize = %q, want %q", got, want)
+	}
+}
+
+func TestFuseRankings(t *testing.T) {
+	vector := []PineconeMatch{{ID: "a"}, {ID: "b"}, {ID: "c"}}
+	lexical := []PineconeMatch{{ID: "c"}, {ID: "a"}}
+
+	fused := fuseRankings(vector, lexical)
+	if ids := matchIDs(fused); !reflect.DeepEqual(ids, []string{"a", "c", "b"}) {
+		t.Errorf("fused order %v", ids)
+	}
+
+	fused = fuseRankings(vector, vector)
+	if fused[0].Score != 1 {
+		t.Errorf("a match ranked first in every list scores %v, want 1", fused[0].Score)
+	}
+}
@@ -1,11 +1,14 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"html/template"
 	"log"
 	"net/http"
 	"os"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 	"github.com/joho/godotenv"
@@ -18,6 +21,12 @@ func main() {
 		log.Println("Warning: .env file not found, using system environment variables")
 	}
 
+	// Retry rate limits and transient failures of every upstream client
+	retryPolicy, err = loadRetryPolicy()
+	if err != nil {
+		log.Fatalf("Failed to load retry policy: %v", err)
+	}
+
 	// Initialize clients
 	pineconeAPI := NewPineconeClient(
 		os.Getenv("PINECONE_API_KEY"),
@@ -25,16 +34,130 @@ func main() {
 		os.Getenv("PINECONE_V2_INDEX"),
 	)
 
-	voyageAPI := NewVoyageClient(os.Getenv("VOYAGE_API_KEY"))
+	// Embed with Voyage or any OpenAI-compatible embeddings server
+	var embedder Embedder
+	switch os.Getenv("EMBEDDER") {
+	case "", "voyage":
+		embedder = NewVoyageClient(
+			getStringDefault(os.Getenv("EMBED_API_KEY"), os.Getenv("VOYAGE_API_KEY")),
+			getStringDefault(os.Getenv("EMBED_URL"), defaultVoyageURL),
+			getStringDefault(os.Getenv("EMBED_MODEL"), defaultVoyageModel),
+		)
+	case "openai":
+		if os.Getenv("EMBED_MODEL") == "" {
+			log.Fatalf("EMBEDDER=openai needs EMBED_MODEL")
+		}
+		embedder = NewOpenAIEmbeddingClient(
+			os.Getenv("EMBED_API_KEY"),
+			getStringDefault(os.Getenv("EMBED_URL"), defaultOpenAIEmbeddingURL),
+			os.Getenv("EMBED_MODEL"),
+		)
+	default:
+		log.Fatalf("Unknown EMBEDDER %q (expected voyage or openai)", os.Getenv("EMBEDDER"))
+	}
+
+	// Record embedding tokens per request path against a daily budget
+	var dailyBudget int64
+	if value := os.Getenv("EMBED_DAILY_BUDGET"); value != "" {
+		if dailyBudget, err = strconv.ParseInt(value, 10, 64); err != nil || dailyBudget < 0 {
+			log.Fatalf("Invalid EMBED_DAILY_BUDGET %q", value)
+		}
+	}
+	usage := NewUsageLedger(dailyBudget)
+
+	// Gather concurrent embedding calls into batched requests
+	batchWindow := defaultEmbedBatchWindow
+	if value := os.Getenv("EMBED_BATCH_WINDOW"); value != "" {
+		if batchWindow, err = time.ParseDuration(value); err != nil || batchWindow < 0 {
+			log.Fatalf("Invalid EMBED_BATCH_WINDOW %q", value)
+		}
+	}
+	batchSize := defaultEmbedBatchSize
+	if value := os.Getenv("EMBED_BATCH_SIZE"); value != "" {
+		if batchSize, err = strconv.Atoi(value); err != nil || batchSize <= 0 {
+			log.Fatalf("Invalid EMBED_BATCH_SIZE %q", value)
+		}
+	}
+	embedder = NewEmbeddingBatcher(embedder, batchWindow, batchSize, usage)
+
+	// Past the daily budget, only cached embeddings are served
+	embedder = &budgetedEmbedder{embedder: embedder, usage: usage}
+
+	// Cache embeddings in memory, and on disk when a directory is set
+	cacheSize := defaultEmbedCacheSize
+	if value := os.Getenv("EMBED_CACHE_SIZE"); value != "" {
+		if cacheSize, err = strconv.Atoi(value); err != nil || cacheSize <= 0 {
+			log.Fatalf("Invalid EMBED_CACHE_SIZE %q", value)
+		}
+	}
+	embedCache, err := NewEmbeddingCache(embedder, cacheSize, os.Getenv("EMBED_CACHE_DIR"))
+	if err != nil {
+		log.Fatalf("Failed to create embedding cache: %v", err)
+	}
+
+	// Bound each stage of a search, cancelling upstream calls on expiry
+	timeouts, err := loadStageTimeouts()
+	if err != nil {
+		log.Fatalf("Failed to load timeouts: %v", err)
+	}
+
+	// Rerank vector candidates with a cross-encoder when one is configured
+	var reranker Reranker = noopReranker{}
+	switch os.Getenv("RERANKER") {
+	case "", "none":
+	case "voyage":
+		candidates := defaultRerankCandidates
+		if value := os.Getenv("RERANK_CANDIDATES"); value != "" {
+			if candidates, err = strconv.Atoi(value); err != nil || candidates <= 0 {
+				log.Fatalf("Invalid RERANK_CANDIDATES %q", value)
+			}
+		}
+		reranker = NewRerankClient(
+			getStringDefault(os.Getenv("RERANK_API_KEY"), os.Getenv("VOYAGE_API_KEY")),
+			getStringDefault(os.Getenv("RERANK_URL"), defaultRerankURL),
+			getStringDefault(os.Getenv("RERANK_MODEL"), defaultRerankModel),
+			candidates,
+		)
+	default:
+		log.Fatalf("Unknown RERANKER %q (expected none or voyage)", os.Getenv("RERANKER"))
+	}
+
+	// Resolve logical corpora to Pinecone indexes and namespaces
+	registry, err := loadCorpora(os.Getenv("CORPORA_CONFIG"))
+	if err != nil {
+		log.Fatalf("Failed to load corpora: %v", err)
+	}
+	connectCorpora(registry, os.Getenv("PINECONE_API_KEY"), pineconeAPI)
+	corpora = registry
+	log.Printf("Corpora: %s", corpusNames(corpora))
+
+	// Refuse to start with a model whose vectors don't fit the indexes
+	checkCtx, cancel := context.WithTimeout(withUsagePath(context.Background(), usageStartup), timeouts.Embed+timeouts.Retrieve)
+	err = checkEmbeddingDimension(checkCtx, embedCache, corpora)
+	cancel()
+	if err != nil {
+		log.Fatalf("Embedding dimension mismatch: %v", err)
+	}
 
 	// Load templates
 	templates := template.Must(template.ParseGlob("templates/*.html"))
 
 	app := &App{
-		templates:   templates,
-		pineconeAPI: pineconeAPI,
-		voyageAPI:   voyageAPI,
-		rssCache:    make(map[string]RSSCacheItem),
+		templates:    templates,
+		pineconeAPI:  pineconeAPI,
+		embedder:     embedCache,
+		embedCache:   embedCache,
+		usage:        usage,
+		lexicalIndex: newLexicalIndex(),
+		reranker:     reranker,
+		timeouts:     timeouts,
+		rssCache:     make(map[string]RSSCacheItem),
+	}
+
+	// Operational statistics are only served with the admin token
+	adminToken := os.Getenv("ADMIN_TOKEN")
+	if adminToken == "" {
+		log.Printf("ADMIN_TOKEN not set, admin endpoints are disabled")
 	}
 
 	// Setup routes
@@ -45,11 +168,15 @@ func main() {
 	
 	// Routes
 	r.HandleFunc("/", app.handleHome).Methods("GET")
-	r.HandleFunc("/search", app.handleSearch).Methods("GET")
-	r.HandleFunc("/api/search", app.handleAPISearch).Methods("GET", "POST")
-	r.HandleFunc("/api/export/opml", app.handleOPMLExport).Methods("GET", "POST")
-	r.HandleFunc("/api/export/csv", app.handleCSVExport).Methods("GET", "POST")
-	r.HandleFunc("/rss", app.handleRSSFeed).Methods("GET")
+	r.HandleFunc("/search", usageHandler(usageSearch, app.handleSearch)).Methods("GET")
+	r.HandleFunc("/api/search", usageHandler(usageSearch, app.handleAPISearch)).Methods("GET", "POST")
+	r.HandleFunc("/api/trend", usageHandler(usageTrend, app.handleAPITrend)).Methods("GET")
+	r.HandleFunc("/api/cache/embeddings", adminHandler(adminToken, app.handleEmbeddingCacheStats)).Methods("GET")
+	r.HandleFunc("/api/upstream/retries", adminHandler(adminToken, app.handleRetryStats)).Methods("GET")
+	r.HandleFunc("/api/admin/usage", adminHandler(adminToken, app.handleUsageReport)).Methods("GET")
+	r.HandleFunc("/api/export/opml", usageHandler(usageExport, app.handleOPMLExport)).Methods("GET", "POST")
+	r.HandleFunc("/api/export/csv", usageHandler(usageExport, app.handleCSVExport)).Methods("GET", "POST")
+	r.HandleFunc("/rss", usageHandler(usageRSS, app.handleRSSFeed)).Methods("GET")
 
 	// Start server
 	port := "8000"
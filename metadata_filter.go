@@ -0,0 +1,135 @@
+package main
+
+import "fmt"
+
+// matchesFilter evaluates a rendered Pinecone metadata filter against a
+// match's metadata, so that results found outside Pinecone obey the same
+// filters. A list-valued metadata field matches if any of its elements does.
+func matchesFilter(metadata map[string]interface{}, filter map[string]interface{}) bool {
+	for key, value := range filter {
+		switch key {
+		case "$and":
+			for _, child := range toInterfaceSlice(value) {
+				if sub, ok := child.(map[string]interface{}); ok && !matchesFilter(metadata, sub) {
+					return false
+				}
+			}
+		case "$or":
+			matched := false
+			for _, child := range toInterfaceSlice(value) {
+				if sub, ok := child.(map[string]interface{}); ok && matchesFilter(metadata, sub) {
+					matched = true
+					break
+				}
+			}
+			if !matched {
+				return false
+			}
+		default:
+			cond, ok := value.(map[string]interface{})
+			if !ok {
+				// Shorthand {field: value} means $eq
+				cond = map[string]interface{}{"$eq": value}
+			}
+			if !matchesCondition(metadata[key], cond) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// matchesCondition evaluates every comparison in a single-field condition.
+// Missing fields only satisfy $ne and $nin.
+func matchesCondition(actual interface{}, cond map[string]interface{}) bool {
+	for op, want := range cond {
+		var ok bool
+		switch op {
+		case "$eq":
+			ok = anyMetadataValue(actual, func(v interface{}) bool { return metadataEqual(v, want) })
+		case "$ne":
+			ok = !anyMetadataValue(actual, func(v interface{}) bool { return metadataEqual(v, want) })
+		case "$in":
+			ok = anyMetadataValue(actual, func(v interface{}) bool { return containsMetadataValue(want, v) })
+		case "$nin":
+			ok = !anyMetadataValue(actual, func(v interface{}) bool { return containsMetadataValue(want, v) })
+		case "$gt", "$gte", "$lt", "$lte":
+			ok = anyMetadataValue(actual, func(v interface{}) bool { return compareMetadata(op, v, want) })
+		}
+		if !ok {
+			return false
+		}
+	}
+	return true
+}
+
+// anyMetadataValue applies test to a scalar value or to each element of a list
+func anyMetadataValue(actual interface{}, test func(interface{}) bool) bool {
+	if actual == nil {
+		return false
+	}
+	if list, ok := actual.([]interface{}); ok {
+		for _, v := range list {
+			if test(v) {
+				return true
+			}
+		}
+		return false
+	}
+	return test(actual)
+}
+
+// containsMetadataValue reports whether a filter list contains a value
+func containsMetadataValue(list, value interface{}) bool {
+	for _, candidate := range toInterfaceSlice(list) {
+		if metadataEqual(value, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+// metadataEqual compares metadata values, treating all numbers alike
+func metadataEqual(a, b interface{}) bool {
+	if x, ok := metadataNumber(a); ok {
+		y, ok := metadataNumber(b)
+		return ok && x == y
+	}
+	return fmt.Sprint(a) == fmt.Sprint(b)
+}
+
+// compareMetadata applies a numeric range operator
+func compareMetadata(op string, actual, bound interface{}) bool {
+	x, ok := metadataNumber(actual)
+	if !ok {
+		return false
+	}
+	y, ok := metadataNumber(bound)
+	if !ok {
+		return false
+	}
+	switch op {
+	case "$gt":
+		return x > y
+	case "$gte":
+		return x >= y
+	case "$lt":
+		return x < y
+	case "$lte":
+		return x <= y
+	}
+	return false
+}
+
+// metadataNumber converts the numeric types used in metadata and filters
+func metadataNumber(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
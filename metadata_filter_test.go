@@ -0,0 +1,69 @@
+package main
+
+import "testing"
+
+func TestMatchesFilter(t *testing.T) {
+	metadata := map[string]interface{}{
+		"lang":      "en",
+		"base_url":  "a.com",
+		"unix_time": float64(1700000000),
+		"tags":      []interface{}{"rust", "async"},
+	}
+	tests := []struct {
+		name   string
+		filter map[string]interface{}
+		want   bool
+	}{
+		{"empty", map[string]interface{}{}, true},
+		{"$eq", map[string]interface{}{"lang": map[string]interface{}{"$eq": "en"}}, true},
+		{"shorthand", map[string]interface{}{"lang": "de"}, false},
+		{"$ne", map[string]interface{}{"lang": map[string]interface{}{"$ne": "en"}}, false},
+		{"$in", map[string]interface{}{"base_url": map[string]interface{}{"$in": []interface{}{"a.com", "b.com"}}}, true},
+		{"$in strings", map[string]interface{}{"base_url": map[string]interface{}{"$in": []string{"b.com"}}}, false},
+		{"$nin", map[string]interface{}{"lang": map[string]interface{}{"$nin": []interface{}{"de", "fr"}}}, true},
+		{"range with int64 bound", map[string]interface{}{"unix_time": map[string]interface{}{"$gte": int64(1600000000), "$lt": int64(1800000000)}}, true},
+		{"range excluded", map[string]interface{}{"unix_time": map[string]interface{}{"$gt": 1700000000}}, false},
+		{"list element", map[string]interface{}{"tags": map[string]interface{}{"$eq": "async"}}, true},
+		{"list $nin", map[string]interface{}{"tags": map[string]interface{}{"$nin": []interface{}{"rust"}}}, false},
+		{"missing field $eq", map[string]interface{}{"owner": map[string]interface{}{"$eq": "x"}}, false},
+		{"missing field $ne", map[string]interface{}{"owner": map[string]interface{}{"$ne": "x"}}, true},
+		{"$or", map[string]interface{}{"$or": []interface{}{
+			map[string]interface{}{"lang": map[string]interface{}{"$eq": "de"}},
+			map[string]interface{}{"base_url": map[string]interface{}{"$eq": "a.com"}},
+		}}, true},
+		{"$and", map[string]interface{}{"$and": []interface{}{
+			map[string]interface{}{"lang": map[string]interface{}{"$eq": "en"}},
+			map[string]interface{}{"base_url": map[string]interface{}{"$eq": "b.com"}},
+		}}, false},
+	}
+	for _, tt := range tests {
+		if got := matchesFilter(metadata, tt.filter); got != tt.want {
+			t.Errorf("%s: matchesFilter = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+// Filters compiled from queries must agree with the matcher, since lexical
+// hits are filtered in process
+func TestMatchesCompiledFilter(t *testing.T) {
+	metadata := map[string]interface{}{"lang": "en", "base_url": "a.com"}
+	tests := []struct {
+		query string
+		want  bool
+	}{
+		{"lang:en", true},
+		{"lang:en OR lang:de", true},
+		{"-lang:en -lang:de", false},
+		{"-(lang:en site:b.com)", true},
+		{"site:b.com OR lang:de", false},
+	}
+	for _, tt := range tests {
+		sq, err := parseSearchQuery(tt.query)
+		if err != nil {
+			t.Fatalf("%q: %v", tt.query, err)
+		}
+		if got := matchesFilter(metadata, sq.Filters); got != tt.want {
+			t.Errorf("%q: matchesFilter = %v, want %v", tt.query, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package main
+
+import "sort"
+
+const (
+	// defaultNegationWeight removes the negated concept from the query vector
+	defaultNegationWeight = 1.0
+	// maxNegationWeight bounds how far past removal a query can be pushed
+	maxNegationWeight = 2.0
+)
+
+// adjustForNegation moves the query vector away from the negated concept by
+// subtracting weight times its projection onto the negation direction
+func adjustForNegation(query, negation []float64, weight float64) []float64 {
+	direction := normalizeVector(negation)
+	projection := dotProduct(query, direction)
+
+	adjusted := make([]float64, len(query))
+	for i := range query {
+		adjusted[i] = query[i] - weight*projection*direction[i]
+	}
+	return normalizeVector(adjusted)
+}
+
+// rerankAwayFromNegation rescores matches by their similarity to the original
+// query minus weight times their similarity to the negated concept. Matches
+// that sit closer to the negated concept than to the query are dropped.
+// Matches must have been fetched with their vector values.
+func rerankAwayFromNegation(matches []PineconeMatch, query, negation []float64, weight float64) []PineconeMatch {
+	kept := make([]PineconeMatch, 0, len(matches))
+	for _, match := range matches {
+		if len(match.Values) == 0 {
+			kept = append(kept, match)
+			continue
+		}
+		querySim := cosineSimilarity(match.Values, query)
+		negationSim := cosineSimilarity(match.Values, negation)
+		if negationSim > querySim {
+			continue
+		}
+		match.Score = querySim - weight*negationSim
+		kept = append(kept, match)
+	}
+
+	sort.SliceStable(kept, func(i, j int) bool {
+		return kept[i].Score > kept[j].Score
+	})
+	return kept
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+)
+
+// The spare candidates fetched to steer away from a <negation> must stay
+// within Pinecone's top_k limit, however deep the page
+func TestNegationTopK(t *testing.T) {
+	var topK int
+	app := searchTestApp(t, func(w http.ResponseWriter, r *http.Request) {
+		var query PineconeQueryRequest
+		json.NewDecoder(r.Body).Decode(&query)
+		topK = query.TopK
+		fmt.Fprint(w, `{"matches": []}`)
+	})
+
+	tests := []struct {
+		offset, limit, want int
+	}{
+		{0, 50, 200},
+		{600, 200, pineconeMaxTopK},
+	}
+	for _, tt := range tests {
+		req := &SearchRequest{Text: "rust <game>", Offset: tt.offset, Limit: tt.limit}
+		if _, err := app.performSearch(context.Background(), req); err != nil {
+			t.Fatal(err)
+		}
+		if topK != tt.want {
+			t.Errorf("offset %d limit %d: top_k %d, want %d", tt.offset, tt.limit, topK, tt.want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"strconv"
+)
+
+const (
+	// maxSearchLimit caps the number of results on a single page
+	maxSearchLimit = 200
+	// maxSearchWindow caps how deep offset plus limit may reach, since every
+	// page is served from a fresh top-k vector query
+	maxSearchWindow = 1000
+	// reorderWindow is the fixed pool of candidates retrieved for every page
+	// of a search whose results are reordered after retrieval
+	reorderWindow = 500
+)
+
+// searchCursor is the state carried by an opaque pagination cursor
+type searchCursor struct {
+	Offset      int    `json:"o"`
+	Limit       int    `json:"l"`
+	Fingerprint string `json:"f"`
+}
+
+// fingerprint identifies the search a cursor belongs to, so that a cursor
+// can't silently be replayed against a different query
+func (req *SearchRequest) fingerprint() string {
+	data, _ := json.Marshal(struct {
+		Text      string
+		Filters   SearchFilters
+		Namespace string
+		Sort      []string
+		Rank      string
+	}{req.Text, req.Filters, getStringDefault(req.Namespace, "posts"), req.Sort, req.Rank})
+
+	h := fnv.New64a()
+	h.Write(data)
+	return strconv.FormatUint(h.Sum64(), 36)
+}
+
+// encodeCursor returns the cursor for the page at offset
+func (req *SearchRequest) encodeCursor(offset int) string {
+	data, _ := json.Marshal(searchCursor{
+		Offset:      offset,
+		Limit:       req.limit(),
+		Fingerprint: req.fingerprint(),
+	})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// resolvePage applies any cursor to Offset and Limit and enforces the
+// server-side caps, recording problems in c
+func (req *SearchRequest) resolvePage(c *queryCompiler) {
+	if req.Cursor != "" {
+		var cursor searchCursor
+		data, err := base64.RawURLEncoding.DecodeString(req.Cursor)
+		if err == nil {
+			err = json.Unmarshal(data, &cursor)
+		}
+		switch {
+		case err != nil:
+			c.errs = append(c.errs, &QueryError{Field: "cursor", Message: "malformed cursor"})
+		case cursor.Fingerprint != req.fingerprint():
+			c.errs = append(c.errs, &QueryError{Field: "cursor", Message: "cursor belongs to a different search"})
+		default:
+			req.Offset = cursor.Offset
+			req.Limit = cursor.Limit
+		}
+	}
+
+	if req.Limit < 0 {
+		c.errs = append(c.errs, &QueryError{Field: "limit", Message: "must not be negative"})
+	}
+	if req.Offset < 0 {
+		c.errs = append(c.errs, &QueryError{Field: "offset", Message: "must not be negative"})
+	}
+	if req.Limit > maxSearchLimit {
+		req.Limit = maxSearchLimit
+	}
+	switch {
+	case c.sq.reordered() && req.Offset+req.limit() > reorderWindow:
+		c.errs = append(c.errs, &QueryError{Field: "offset", Message: fmt.Sprintf("results beyond the first %d can't be paged to when they are ranked, reranked, diversified or sorted", reorderWindow)})
+	case req.Offset+req.limit() > maxSearchWindow:
+		c.errs = append(c.errs, &QueryError{Field: "offset", Message: fmt.Sprintf("results beyond the first %d can't be paged to", maxSearchWindow)})
+	}
+}
+
+// reordered reports whether results are reordered after retrieval by a rank
+// profile, the reranker, diversification or a sort. A page is then cut from an order over
+// the whole pool of candidates, so the pool can't grow with the offset or
+// pages would repeat and skip results.
+func (sq *SearchQuery) reordered() bool {
+	if sq.Rank != defaultRankProfile || len(sq.Sort) > 0 || sq.Reranked {
+		return true
+	}
+	// Posts are diversified, and those of a site: search sorted by date
+	return !sq.IsFeedSearch && (sq.Diversity > 0 || sq.HasSiteFilter)
+}
+
+// searchWindow returns how many candidates to retrieve for the request: up
+// to the end of the page plus one page of lookahead, so that the response
+// can report a total and whether a next page exists. Reordered searches
+// retrieve the same fixed pool for every page instead. Facets widen the
+// window so that their counts cover more than the page.
+func (req *SearchRequest) searchWindow(sq *SearchQuery) int {
+	window := req.Offset + 2*req.limit()
+	if sq.reordered() {
+		window = reorderWindow
+	}
+	if req.Facets && window < facetWindow {
+		window = facetWindow
+	}
+	if window > maxSearchWindow {
+		window = maxSearchWindow
+	}
+	return window
+}
+
+// paginate cuts the page for the request out of all candidates and fills in
+// the paging fields of the response
+func (req *SearchRequest) paginate(results []SearchResult, response *SearchResponse) {
+	limit := req.limit()
+	response.TotalResults = len(results)
+	response.Offset = req.Offset
+	response.Limit = limit
+
+	if req.Offset >= len(results) {
+		response.Results = []SearchResult{}
+	} else {
+		end := req.Offset + limit
+		if end > len(results) {
+			end = len(results)
+		}
+		response.Results = results[req.Offset:end]
+	}
+
+	if req.Offset+limit < len(results) {
+		response.NextCursor = req.encodeCursor(req.Offset + limit)
+	}
+	if req.Offset > 0 {
+		prev := req.Offset - limit
+		if prev < 0 {
+			prev = 0
+		}
+		response.PrevCursor = req.encodeCursor(prev)
+	}
+}
+
+// pageURL returns the URL of the page addressed by cursor, keeping the other
+// query parameters of base
+func pageURL(base *url.URL, cursor string) string {
+	if cursor == "" {
+		return ""
+	}
+	params := base.Query()
+	params.Del("offset")
+	params.Set("cursor", cursor)
+	return base.Path + "?" + params.Encode()
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+// relevanceQuery is a search whose results keep their retrieval order
+var relevanceQuery = SearchQuery{Rank: defaultRankProfile}
+
+// pageErrors resolves the page of req and returns the fields with problems
+func pageErrors(req *SearchRequest) []string {
+	return queryPageErrors(req, relevanceQuery)
+}
+
+// queryPageErrors resolves the page of req for sq
+func queryPageErrors(req *SearchRequest, sq SearchQuery) []string {
+	c := &queryCompiler{sq: &sq}
+	req.resolvePage(c)
+	var fields []string
+	for _, err := range c.errs {
+		fields = append(fields, err.Field)
+	}
+	return fields
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	first := &SearchRequest{Text: "rust lang:en", Limit: 20}
+	cursor := first.encodeCursor(40)
+
+	next := &SearchRequest{Text: "rust lang:en", Cursor: cursor}
+	if errs := pageErrors(next); errs != nil {
+		t.Fatalf("unexpected errors for %v", errs)
+	}
+	if next.Offset != 40 || next.Limit != 20 {
+		t.Errorf("cursor resolved to offset %d, limit %d", next.Offset, next.Limit)
+	}
+
+	other := &SearchRequest{Text: "go lang:en", Cursor: cursor}
+	if errs := pageErrors(other); len(errs) != 1 || errs[0] != "cursor" {
+		t.Errorf("cursor of another search: errors for %v", errs)
+	}
+
+	malformed := &SearchRequest{Text: "rust lang:en", Cursor: "not a cursor"}
+	if errs := pageErrors(malformed); len(errs) != 1 || errs[0] != "cursor" {
+		t.Errorf("malformed cursor: errors for %v", errs)
+	}
+}
+
+func TestResolvePageLimits(t *testing.T) {
+	req := &SearchRequest{Limit: 500}
+	if errs := pageErrors(req); errs != nil || req.Limit != maxSearchLimit {
+		t.Errorf("limit 500: limit %d, errors for %v", req.Limit, errs)
+	}
+
+	req = &SearchRequest{Offset: -1, Limit: -1}
+	if errs := pageErrors(req); len(errs) != 2 {
+		t.Errorf("negative offset and limit: errors for %v", errs)
+	}
+
+	req = &SearchRequest{Offset: maxSearchWindow - 10, Limit: 20}
+	if errs := pageErrors(req); len(errs) != 1 || errs[0] != "offset" {
+		t.Errorf("page past the window: errors for %v", errs)
+	}
+
+	fresh := SearchQuery{Rank: "fresh"}
+	req = &SearchRequest{Offset: reorderWindow - 20, Limit: 20}
+	if errs := queryPageErrors(req, fresh); errs != nil {
+		t.Errorf("last page of a ranked pool: errors for %v", errs)
+	}
+	req = &SearchRequest{Offset: reorderWindow, Limit: 20}
+	if errs := queryPageErrors(req, fresh); len(errs) != 1 || errs[0] != "offset" {
+		t.Errorf("page past a ranked pool: errors for %v", errs)
+	}
+}
+
+func TestSearchWindow(t *testing.T) {
+	diversified := SearchQuery{Rank: defaultRankProfile, Diversity: 0.5}
+	tests := []struct {
+		req  SearchRequest
+		sq   SearchQuery
+		want int
+	}{
+		{SearchRequest{}, relevanceQuery, 2 * defaultSearchLimit},
+		{SearchRequest{Offset: 100, Limit: 20}, relevanceQuery, 140},
+		{SearchRequest{Limit: 20, Facets: true}, relevanceQuery, facetWindow},
+		{SearchRequest{Offset: 900, Limit: 100}, relevanceQuery, maxSearchWindow},
+		{SearchRequest{Limit: 20}, SearchQuery{Rank: "fresh"}, reorderWindow},
+		{SearchRequest{Offset: 200, Limit: 20}, diversified, reorderWindow},
+		{SearchRequest{Offset: 200, Limit: 20}, SearchQuery{Rank: defaultRankProfile, Sort: []SortKey{{Field: "date"}}}, reorderWindow},
+		{SearchRequest{Offset: 200, Limit: 20}, SearchQuery{Rank: defaultRankProfile, HasSiteFilter: true}, reorderWindow},
+		{SearchRequest{Offset: 200, Limit: 20}, SearchQuery{Rank: defaultRankProfile, Diversity: 0.5, IsFeedSearch: true}, 240},
+	}
+	for _, tt := range tests {
+		if got := tt.req.searchWindow(&tt.sq); got != tt.want {
+			t.Errorf("offset %d limit %d facets %v, %+v: window %d, want %d", tt.req.Offset, tt.req.Limit, tt.req.Facets, tt.sq, got, tt.want)
+		}
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	results := make([]SearchResult, 25)
+	for i := range results {
+		results[i].URL = "https://example.com/" + string(rune('a'+i))
+	}
+
+	tests := []struct {
+		offset, limit int
+		first         string
+		count         int
+		next, prev    bool
+	}{
+		{0, 10, "https://example.com/a", 10, true, false},
+		{10, 10, "https://example.com/k", 10, true, true},
+		{20, 10, "https://example.com/u", 5, false, true},
+		{30, 10, "", 0, false, true},
+	}
+	for _, tt := range tests {
+		req := &SearchRequest{Offset: tt.offset, Limit: tt.limit}
+		var response SearchResponse
+		req.paginate(results, &response)
+		if response.TotalResults != 25 || len(response.Results) != tt.count {
+			t.Errorf("offset %d: total %d, %d results", tt.offset, response.TotalResults, len(response.Results))
+			continue
+		}
+		if tt.count > 0 && response.Results[0].URL != tt.first {
+			t.Errorf("offset %d: first result %s, want %s", tt.offset, response.Results[0].URL, tt.first)
+		}
+		if (response.NextCursor != "") != tt.next || (response.PrevCursor != "") != tt.prev {
+			t.Errorf("offset %d: next cursor %q, prev cursor %q", tt.offset, response.NextCursor, response.PrevCursor)
+		}
+	}
+}
+
+func TestPageURL(t *testing.T) {
+	base, _ := url.Parse("/search?qry=rust&offset=50&limit=10")
+	got := pageURL(base, "abc")
+	if !strings.HasPrefix(got, "/search?") || strings.Contains(got, "offset=") ||
+		!strings.Contains(got, "cursor=abc") || !strings.Contains(got, "qry=rust") {
+		t.Errorf("pageURL = %q", got)
+	}
+	if pageURL(base, "") != "" {
+		t.Error("pageURL without a cursor should be empty")
+	}
+}
+
+// pineconeCorpus answers every query with topK matches in descending score,
+// published on days that don't follow the score order
+func pineconeCorpus(w http.ResponseWriter, r *http.Request) {
+	var query struct {
+		TopK int `json:"topK"`
+	}
+	json.NewDecoder(r.Body).Decode(&query)
+	matches := make([]PineconeMatch, query.TopK)
+	for i := range matches {
+		published := time.Now().AddDate(0, 0, -(i*37)%query.TopK)
+		matches[i] = PineconeMatch{
+			ID:    fmt.Sprintf("https://site%d.example.com/post", i),
+			Score: 1 - float64(i)/2000,
+			Metadata: map[string]interface{}{
+				"title":        fmt.Sprintf("Post %d", i),
+				"base_url":     fmt.Sprintf("https://site%d.example.com", i),
+				"dt_published": published.Format(time.RFC3339),
+			},
+		}
+	}
+	json.NewEncoder(w).Encode(map[string]interface{}{"matches": matches})
+}
+
+// Consecutive pages of a ranked search are cut from one order, so none of
+// them repeats or skips a result
+func TestRankedPagesShareOnePool(t *testing.T) {
+	app := searchTestApp(t, pineconeCorpus)
+	search := func(offset, limit int) []string {
+		req := &SearchRequest{Text: "rust rank:fresh", Offset: offset, Limit: limit}
+		response, err := app.performSearch(context.Background(), req)
+		if err != nil {
+			t.Fatalf("offset %d: %v", offset, err)
+		}
+		return resultURLs(response.Results)
+	}
+
+	whole := search(0, 30)
+	paged := append(append(search(0, 10), search(10, 10)...), search(20, 10)...)
+	if strings.Join(paged, " ") != strings.Join(whole, " ") {
+		t.Errorf("pages of 10 differ from a page of 30:\n%v\n%v", paged, whole)
+	}
+}
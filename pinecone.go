@@ -2,13 +2,20 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
 	"net/http"
-	"time"
 )
 
+// errVectorNotFound is returned when a fetched ID isn't in the namespace
+var errVectorNotFound = errors.New("vector not found")
+
+// pineconeMaxTopK is the most matches a query may ask for when it includes
+// metadata or values
+const pineconeMaxTopK = 1000
+
 type PineconeClient struct {
 	apiKey string
 	host   string
@@ -44,18 +51,30 @@ type PineconeFetchResponse struct {
 	} `json:"vectors"`
 }
 
+type PineconeIndexStats struct {
+	Dimension int `json:"dimension"`
+}
+
 func NewPineconeClient(apiKey, host, index string) *PineconeClient {
 	return &PineconeClient{
 		apiKey: apiKey,
 		host:   host,
 		index:  index,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		// Deadlines come from the context of each call
+		client: newRetryingClient("pinecone"),
 	}
 }
 
-func (pc *PineconeClient) Query(namespace string, embedding []float64, filters map[string]interface{}, topK int) ([]PineconeMatch, error) {
+func (pc *PineconeClient) Query(ctx context.Context, namespace string, embedding []float64, filters map[string]interface{}, topK int) ([]PineconeMatch, error) {
+	return pc.query(ctx, namespace, embedding, filters, topK, false)
+}
+
+// QueryWithValues is like Query but also returns each match's vector
+func (pc *PineconeClient) QueryWithValues(ctx context.Context, namespace string, embedding []float64, filters map[string]interface{}, topK int) ([]PineconeMatch, error) {
+	return pc.query(ctx, namespace, embedding, filters, topK, true)
+}
+
+func (pc *PineconeClient) query(ctx context.Context, namespace string, embedding []float64, filters map[string]interface{}, topK int, includeValues bool) ([]PineconeMatch, error) {
 	if len(embedding) == 0 {
 		return []PineconeMatch{}, nil
 	}
@@ -65,7 +84,7 @@ func (pc *PineconeClient) Query(namespace string, embedding []float64, filters m
 		Vector:          embedding,
 		TopK:            topK,
 		IncludeMetadata: true,
-		IncludeValues:   false,
+		IncludeValues:   includeValues,
 		Namespace:       namespace,
 		Filter:          filters,
 	}
@@ -82,12 +101,14 @@ func (pc *PineconeClient) Query(namespace string, embedding []float64, filters m
 
 	// Make HTTP request
 	url := fmt.Sprintf("%s/query", pc.host)
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	// Queries only read, so they are safe to retry
+	markIdempotent(req)
 	req.Header.Set("Api-Key", pc.apiKey)
 
 	resp, err := pc.client.Do(req)
@@ -97,8 +118,7 @@ func (pc *PineconeClient) Query(namespace string, embedding []float64, filters m
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("pinecone API error %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError("pinecone API", resp)
 	}
 
 	// Parse response
@@ -110,16 +130,16 @@ func (pc *PineconeClient) Query(namespace string, embedding []float64, filters m
 	return response.Matches, nil
 }
 
-func (pc *PineconeClient) GetEmbedding(id string) ([]float64, error) {
+func (pc *PineconeClient) GetEmbedding(ctx context.Context, id string) ([]float64, error) {
 	// Fetch vector from Pinecone by ID using default namespace
-	return pc.GetEmbeddingFromNamespace(id, pc.index)
+	return pc.GetEmbeddingFromNamespace(ctx, id, pc.index)
 }
 
-func (pc *PineconeClient) GetEmbeddingFromNamespace(id string, namespace string) ([]float64, error) {
+func (pc *PineconeClient) GetEmbeddingFromNamespace(ctx context.Context, id string, namespace string) ([]float64, error) {
 	// Fetch vector from Pinecone by ID from specific namespace
 	url := fmt.Sprintf("%s/vectors/fetch?ids=%s&namespace=%s", pc.host, id, namespace)
 	
-	req, err := http.NewRequest("GET", url, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
@@ -133,8 +153,7 @@ func (pc *PineconeClient) GetEmbeddingFromNamespace(id string, namespace string)
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("pinecone fetch error %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError("pinecone fetch", resp)
 	}
 
 	var response PineconeFetchResponse
@@ -146,5 +165,35 @@ func (pc *PineconeClient) GetEmbeddingFromNamespace(id string, namespace string)
 		return vector.Values, nil
 	}
 
-	return nil, fmt.Errorf("vector not found for ID: %s", id)
+	return nil, fmt.Errorf("%w for ID: %s", errVectorNotFound, id)
+}
+
+// IndexDimension returns the vector dimension of the index
+func (pc *PineconeClient) IndexDimension(ctx context.Context) (int, error) {
+	url := fmt.Sprintf("%s/describe_index_stats", pc.host)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBufferString("{}"))
+	if err != nil {
+		return 0, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	// Queries only read, so they are safe to retry
+	markIdempotent(req)
+	req.Header.Set("Api-Key", pc.apiKey)
+
+	resp, err := pc.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, newAPIError("pinecone stats", resp)
+	}
+
+	var stats PineconeIndexStats
+	if err := json.NewDecoder(resp.Body).Decode(&stats); err != nil {
+		return 0, fmt.Errorf("failed to decode response: %w", err)
+	}
+	return stats.Dimension, nil
 }
\ No newline at end of file
@@ -0,0 +1,1084 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+// SearchQuery contains parsed search parameters
+type SearchQuery struct {
+	Text     string
+	Phrases  []string
+	Filters  map[string]interface{}
+	Sort     []SortKey
+	Negation string
+	// NegationWeight sets how strongly results are pushed away from Negation
+	NegationWeight float64
+	IsLike         bool
+	LikeURL        string
+	IsFeedSearch   bool
+	HasSiteFilter  bool
+	// Mode selects vector, lexical or hybrid retrieval
+	Mode string
+	// PerDomain caps posts per site when set; zero means no cap
+	PerDomain *int
+	// Diversity trades relevance for variety between 0 and 1
+	Diversity float64
+	// Rank names the rank profile used to order results
+	Rank string
+	// IncludeValues fetches result vectors for clustering
+	IncludeValues bool
+	// Reranked is set when a reranker reorders the results
+	Reranked bool
+}
+
+// The query language is a sequence of terms that are implicitly ANDed:
+//
+//	query   := orExpr
+//	orExpr  := andExpr ("OR" andExpr)*
+//	andExpr := unary+
+//	unary   := "-" unary | primary
+//	primary := "(" orExpr ")" | name:value | name:"quoted value" | "phrase" | <negation> | word
+//
+// Free text and phrases are embedded regardless of where they appear, while
+// name:value operators compile into a Pinecone metadata filter that follows
+// the boolean structure of the query.
+
+// queryTokenKind identifies the kind of a lexed query token
+type queryTokenKind int
+
+const (
+	tokenWord queryTokenKind = iota
+	tokenPhrase
+	tokenOperator
+	tokenNegation
+	tokenLParen
+	tokenRParen
+	tokenOr
+	tokenMinus
+	tokenEOF
+)
+
+// queryToken is a single lexed element of a search query
+type queryToken struct {
+	kind  queryTokenKind
+	text  string // word text, phrase contents or negation contents
+	name  string // operator name
+	value string // operator value, or negation weight
+	pos   int    // byte offset in the original query
+}
+
+// queryOperator describes how a name:value operator is applied to a query.
+// Filter operators compile to a condition on a single metadata field, while
+// modifier operators change how the search is performed.
+type queryOperator struct {
+	filter func(value string, c *queryCompiler) (string, map[string]interface{}, error)
+	apply  func(sq *SearchQuery, value string) error
+}
+
+// queryOperators lists every operator understood by the query language
+var queryOperators map[string]queryOperator
+
+func init() {
+	queryOperators = map[string]queryOperator{
+		"type":    {filter: compileTypeFilter},
+		"sype":    {filter: compileSiteTypeFilter},
+		"oype":    {filter: compileOwnerTypeFilter},
+		"since":   {filter: compileSinceFilter},
+		"until":   {filter: compileUntilFilter},
+		"between": {filter: compileBetweenFilter},
+		"site":    {filter: compileSiteFilter},
+		"lang":    {filter: compileLangFilter},
+		"score":   {filter: compileScoreFilter},
+		"length":  {filter: compileLengthFilter},
+		"like": {apply: func(sq *SearchQuery, value string) error {
+			if sq.IsLike {
+				return fmt.Errorf("only one like: is allowed")
+			}
+			sq.IsLike = true
+			sq.LikeURL = value
+			return nil
+		}},
+		"mode": {apply: func(sq *SearchQuery, value string) error {
+			if sq.Mode != "" {
+				return fmt.Errorf("only one mode: is allowed")
+			}
+			if !isSearchMode(value) {
+				return fmt.Errorf("unknown mode %q (expected lexical, vector or hybrid)", value)
+			}
+			sq.Mode = value
+			return nil
+		}},
+		"perdomain": {apply: func(sq *SearchQuery, value string) error {
+			if sq.PerDomain != nil {
+				return fmt.Errorf("only one perdomain: is allowed")
+			}
+			n, err := parsePerDomain(value)
+			if err != nil {
+				return err
+			}
+			sq.PerDomain = &n
+			return nil
+		}},
+		"diversity": {apply: func(sq *SearchQuery, value string) error {
+			d, err := parseDiversity(value)
+			if err != nil {
+				return err
+			}
+			sq.Diversity = d
+			return nil
+		}},
+		"rank": {apply: func(sq *SearchQuery, value string) error {
+			if sq.Rank != "" {
+				return fmt.Errorf("only one rank: is allowed")
+			}
+			name, err := parseRankProfile(value)
+			if err != nil {
+				return err
+			}
+			sq.Rank = name
+			return nil
+		}},
+		"sort": {apply: func(sq *SearchQuery, value string) error {
+			keys, err := parseSortKeys(value)
+			if err != nil {
+				return err
+			}
+			sq.Sort = append(sq.Sort, keys...)
+			return nil
+		}},
+	}
+}
+
+// QueryError describes a problem with one part of a search query. Offset is
+// the character position in the query where the problem starts.
+// Problems with typed request fields set Field instead.
+type QueryError struct {
+	Operator string `json:"operator,omitempty"`
+	Field    string `json:"field,omitempty"`
+	Offset   int    `json:"offset"`
+	Message  string `json:"message"`
+}
+
+func (e *QueryError) Error() string {
+	if e.Field != "" {
+		return fmt.Sprintf("%s: %s", e.Field, e.Message)
+	}
+	if e.Operator != "" {
+		return fmt.Sprintf("%s: at offset %d: %s", e.Operator, e.Offset, e.Message)
+	}
+	return fmt.Sprintf("offset %d: %s", e.Offset, e.Message)
+}
+
+// QueryErrors collects every problem found while parsing a query
+type QueryErrors []*QueryError
+
+func (e QueryErrors) Error() string {
+	msgs := make([]string, len(e))
+	for i, err := range e {
+		msgs[i] = err.Error()
+	}
+	return "invalid query: " + strings.Join(msgs, "; ")
+}
+
+// parseSearchQuery parses the search query string and extracts filters.
+// Any problems are returned together as QueryErrors.
+func parseSearchQuery(query string) (SearchQuery, error) {
+	req := &SearchRequest{Text: query}
+	return req.parse()
+}
+
+// parseQuerySyntax lexes and parses a query into a syntax tree
+func parseQuerySyntax(query string) (queryNode, error) {
+	tokens, err := lexQuery(query)
+	if err != nil {
+		return nil, queryErrorsAt(query, err.(*QueryError))
+	}
+
+	p := &queryParser{tokens: tokens}
+	root, err := p.parse()
+	if err != nil {
+		return nil, queryErrorsAt(query, err.(*QueryError))
+	}
+	return root, nil
+}
+
+// queryErrorsAt converts byte offsets into character offsets within query
+func queryErrorsAt(query string, errs ...*QueryError) QueryErrors {
+	for _, err := range errs {
+		if err.Offset > len(query) {
+			err.Offset = len(query)
+		}
+		err.Offset = utf8.RuneCountInString(query[:err.Offset])
+	}
+	return QueryErrors(errs)
+}
+
+// lexQuery splits a query into tokens, keeping the byte offset of each one
+func lexQuery(query string) ([]queryToken, error) {
+	var tokens []queryToken
+	i := 0
+	for i < len(query) {
+		ch := query[i]
+		switch {
+		case isQuerySpace(ch):
+			i++
+		case ch == '(':
+			tokens = append(tokens, queryToken{kind: tokenLParen, pos: i})
+			i++
+		case ch == ')':
+			tokens = append(tokens, queryToken{kind: tokenRParen, pos: i})
+			i++
+		case ch == '"':
+			end := strings.IndexByte(query[i+1:], '"')
+			if end < 0 {
+				return nil, &QueryError{Offset: i, Message: "unterminated quoted phrase"}
+			}
+			tokens = append(tokens, queryToken{kind: tokenPhrase, text: query[i+1 : i+1+end], pos: i})
+			i += end + 2
+		case ch == '<':
+			end := strings.IndexByte(query[i+1:], '>')
+			if end < 0 {
+				return nil, &QueryError{Offset: i, Message: "unterminated <negation>"}
+			}
+			tok := queryToken{kind: tokenNegation, text: strings.TrimSpace(query[i+1 : i+1+end]), pos: i}
+			i += end + 2
+			// An optional :weight suffix tunes the strength, e.g. <game>:0.5
+			if i < len(query) && query[i] == ':' {
+				j := i + 1
+				for j < len(query) && !isQuerySpace(query[j]) && query[j] != '(' && query[j] != ')' {
+					j++
+				}
+				tok.value = query[i+1 : j]
+				if tok.value == "" {
+					return nil, &QueryError{Offset: i, Message: "missing weight after <negation>:"}
+				}
+				i = j
+			}
+			tokens = append(tokens, tok)
+		case ch == '-' && i+1 < len(query) && !isQuerySpace(query[i+1]) && query[i+1] != '-':
+			tokens = append(tokens, queryToken{kind: tokenMinus, pos: i})
+			i++
+		default:
+			tok, next, err := lexWord(query, i)
+			if err != nil {
+				return nil, err
+			}
+			if tok.kind != tokenEOF {
+				tokens = append(tokens, tok)
+			}
+			i = next
+		}
+	}
+	tokens = append(tokens, queryToken{kind: tokenEOF, pos: len(query)})
+	return tokens, nil
+}
+
+// lexWord reads a bare word or a name:value operator starting at offset start.
+// Operator values may be quoted, and may contain balanced parentheses so that
+// URLs such as like:https://en.wikipedia.org/wiki/Go_(language) survive.
+func lexWord(query string, start int) (queryToken, int, error) {
+	i := start
+	for i < len(query) && !isQuerySpace(query[i]) && query[i] != '(' && query[i] != ')' && query[i] != ':' {
+		i++
+	}
+
+	name := strings.ToLower(query[start:i])
+	if i < len(query) && query[i] == ':' {
+		if _, known := queryOperators[name]; known {
+			valueStart := i + 1
+			if valueStart < len(query) && query[valueStart] == '"' {
+				end := strings.IndexByte(query[valueStart+1:], '"')
+				if end < 0 {
+					return queryToken{}, 0, &QueryError{Operator: name, Offset: start, Message: "unterminated quoted value"}
+				}
+				value := query[valueStart+1 : valueStart+1+end]
+				return queryToken{kind: tokenOperator, name: name, value: value, pos: start}, valueStart + end + 2, nil
+			}
+
+			j, depth := valueStart, 0
+			for j < len(query) && !isQuerySpace(query[j]) {
+				if query[j] == '(' {
+					depth++
+				} else if query[j] == ')' {
+					if depth == 0 {
+						break
+					}
+					depth--
+				}
+				j++
+			}
+			return queryToken{kind: tokenOperator, name: name, value: query[valueStart:j], pos: start}, j, nil
+		}
+	}
+
+	// Not an operator: the word runs to the next space or parenthesis
+	for i < len(query) && !isQuerySpace(query[i]) && query[i] != '(' && query[i] != ')' {
+		i++
+	}
+	word := query[start:i]
+	switch word {
+	case "OR", "|":
+		return queryToken{kind: tokenOr, pos: start}, i, nil
+	case "AND", "&":
+		// AND is implicit between terms
+		return queryToken{kind: tokenEOF}, i, nil
+	}
+	return queryToken{kind: tokenWord, text: word, pos: start}, i, nil
+}
+
+// isQuerySpace reports whether ch separates query terms
+func isQuerySpace(ch byte) bool {
+	return ch == ' ' || ch == '\t' || ch == '\n' || ch == '\r'
+}
+
+// Query syntax tree nodes
+type (
+	queryNode interface{}
+
+	queryAnd struct {
+		children []queryNode
+	}
+
+	queryOr struct {
+		children []queryNode
+	}
+
+	queryNot struct {
+		child queryNode
+		pos   int
+	}
+
+	queryTerm struct {
+		text   string
+		phrase bool
+		pos    int
+	}
+
+	queryOp struct {
+		name  string
+		value string
+		pos   int
+	}
+
+	queryNegation struct {
+		text   string
+		weight string
+		pos    int
+	}
+)
+
+// queryParser is a recursive descent parser over lexed query tokens
+type queryParser struct {
+	tokens []queryToken
+	pos    int
+}
+
+func (p *queryParser) peek() queryToken {
+	return p.tokens[p.pos]
+}
+
+func (p *queryParser) next() queryToken {
+	tok := p.tokens[p.pos]
+	if tok.kind != tokenEOF {
+		p.pos++
+	}
+	return tok
+}
+
+// parse parses the whole token stream into a syntax tree
+func (p *queryParser) parse() (queryNode, error) {
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if tok := p.peek(); tok.kind != tokenEOF {
+		return nil, &QueryError{Offset: tok.pos, Message: "unexpected ')'"}
+	}
+	return node, nil
+}
+
+func (p *queryParser) parseOr() (queryNode, error) {
+	first, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	children := []queryNode{first}
+	for p.peek().kind == tokenOr {
+		orTok := p.next()
+		if len(first.(*queryAnd).children) == 0 {
+			return nil, &QueryError{Offset: orTok.pos, Message: "OR has no left operand"}
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if len(right.(*queryAnd).children) == 0 {
+			return nil, &QueryError{Offset: orTok.pos, Message: "OR has no right operand"}
+		}
+		children = append(children, right)
+	}
+
+	if len(children) == 1 {
+		return first, nil
+	}
+	return &queryOr{children: children}, nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) {
+	and := &queryAnd{}
+	for {
+		switch p.peek().kind {
+		case tokenEOF, tokenRParen, tokenOr:
+			return and, nil
+		}
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		and.children = append(and.children, node)
+	}
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) {
+	if p.peek().kind != tokenMinus {
+		return p.parsePrimary()
+	}
+
+	minus := p.next()
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	// A dash in front of plain text is part of the text, e.g. "-fno-rtti"
+	if term, ok := node.(*queryTerm); ok && !term.phrase {
+		term.text = "-" + term.text
+		term.pos = minus.pos
+		return term, nil
+	}
+	return &queryNot{child: node, pos: minus.pos}, nil
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) {
+	tok := p.next()
+	switch tok.kind {
+	case tokenLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokenRParen {
+			return nil, &QueryError{Offset: tok.pos, Message: "missing ')' for '('"}
+		}
+		return node, nil
+	case tokenWord:
+		return &queryTerm{text: tok.text, pos: tok.pos}, nil
+	case tokenPhrase:
+		return &queryTerm{text: tok.text, phrase: true, pos: tok.pos}, nil
+	case tokenOperator:
+		return &queryOp{name: tok.name, value: tok.value, pos: tok.pos}, nil
+	case tokenNegation:
+		return &queryNegation{text: tok.text, weight: tok.value, pos: tok.pos}, nil
+	case tokenMinus:
+		return nil, &QueryError{Offset: tok.pos, Message: "'-' must be followed by an operator or group"}
+	default:
+		return nil, &QueryError{Offset: tok.pos, Message: "unexpected end of query"}
+	}
+}
+
+// queryCompiler turns a query syntax tree into a SearchQuery
+type queryCompiler struct {
+	sq    *SearchQuery
+	now   time.Time
+	texts []string
+	errs  []*QueryError
+}
+
+// fail records a problem with an operator
+func (c *queryCompiler) fail(op *queryOp, format string, args ...interface{}) {
+	c.errs = append(c.errs, &QueryError{Operator: op.name, Offset: op.pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// compile fills in the text and modifiers of the SearchQuery from the
+// syntax tree and returns its compiled filter, if any
+func (c *queryCompiler) compile(root queryNode) *filterExpr {
+	// Modifiers, text and the feed flag are needed before filters are
+	// compiled, since field names depend on the namespace being searched
+	c.collect(root, false, false)
+	c.sq.Text = strings.TrimSpace(strings.Join(c.texts, " "))
+
+	return c.compileFilter(root, false)
+}
+
+// negate sets the concept the query vector is moved away from
+func (c *queryCompiler) negate(text, weight string, pos int) {
+	if text == "" {
+		c.errs = append(c.errs, &QueryError{Offset: pos, Message: "empty <negation>"})
+	} else if c.sq.Negation != "" {
+		c.errs = append(c.errs, &QueryError{Offset: pos, Message: "only one <negation> is allowed"})
+	}
+	c.sq.Negation = text
+	c.sq.NegationWeight = defaultNegationWeight
+	if weight != "" {
+		value, err := strconv.ParseFloat(weight, 64)
+		if err != nil || value <= 0 || value > maxNegationWeight {
+			c.errs = append(c.errs, &QueryError{Offset: pos, Message: fmt.Sprintf("negation weight %q must be a number above 0 and at most %g", weight, maxNegationWeight)})
+		} else {
+			c.sq.NegationWeight = value
+		}
+	}
+}
+
+// collect gathers free text, negations and modifier operators. Modifiers
+// change the whole search, so they can't be negated or placed inside OR.
+func (c *queryCompiler) collect(node queryNode, negated, inOr bool) {
+	switch n := node.(type) {
+	case *queryAnd:
+		for _, child := range n.children {
+			c.collect(child, negated, inOr)
+		}
+	case *queryOr:
+		for _, child := range n.children {
+			c.collect(child, negated, true)
+		}
+	case *queryNot:
+		// An excluded phrase is a concept to steer away from, like <phrase>
+		if term, ok := n.child.(*queryTerm); ok && term.phrase && !negated && !inOr {
+			c.negate(term.text, "", n.pos)
+			return
+		}
+		c.collect(n.child, !negated, inOr)
+	case *queryTerm:
+		// Embedding excluded text would pull results towards it
+		if negated {
+			c.errs = append(c.errs, &QueryError{Offset: n.pos, Message: fmt.Sprintf("text %q can't be excluded with '-'; use <%s> to steer away from it", n.text, n.text)})
+			return
+		}
+		c.texts = append(c.texts, n.text)
+		if n.phrase {
+			c.sq.Phrases = append(c.sq.Phrases, n.text)
+		}
+	case *queryNegation:
+		c.negate(n.text, n.weight, n.pos)
+	case *queryOp:
+		if n.value == "" {
+			c.fail(n, "missing value")
+			return
+		}
+		if n.name == "site" && !negated {
+			c.sq.HasSiteFilter = true
+		}
+		op := queryOperators[n.name]
+		isFeeds := n.name == "type" && n.value == "feeds"
+		if op.apply == nil && !isFeeds {
+			return
+		}
+		if negated {
+			c.fail(n, "%s:%s can't be negated", n.name, n.value)
+			return
+		}
+		if inOr {
+			c.fail(n, "%s:%s can't be combined with OR", n.name, n.value)
+			return
+		}
+		if isFeeds {
+			c.sq.IsFeedSearch = true
+			return
+		}
+		if err := op.apply(c.sq, n.value); err != nil {
+			c.fail(n, "%v", err)
+		}
+	}
+}
+
+// compileFilter compiles the filter operators beneath node, pushing any
+// negation down to the leaves so that only $ne/$nin style conditions remain
+func (c *queryCompiler) compileFilter(node queryNode, negated bool) *filterExpr {
+	switch n := node.(type) {
+	case *queryAnd:
+		return c.compileGroup(n.children, negated, "$and")
+	case *queryOr:
+		return c.compileGroup(n.children, negated, "$or")
+	case *queryNot:
+		return c.compileFilter(n.child, !negated)
+	case *queryOp:
+		op := queryOperators[n.name]
+		if op.filter == nil || n.value == "" {
+			return nil
+		}
+		field, cond, err := op.filter(n.value, c)
+		if err != nil {
+			c.fail(n, "%v", err)
+			return nil
+		}
+		if field == "" || len(cond) == 0 {
+			return nil
+		}
+		if negated {
+			return negateCondition(field, cond)
+		}
+		return &filterExpr{field: field, cond: cond}
+	}
+	return nil
+}
+
+// compileGroup compiles the children of an AND or OR node, applying
+// De Morgan's laws when the group is negated
+func (c *queryCompiler) compileGroup(children []queryNode, negated bool, op string) *filterExpr {
+	if negated {
+		if op == "$and" {
+			op = "$or"
+		} else {
+			op = "$and"
+		}
+	}
+
+	var exprs []*filterExpr
+	for _, child := range children {
+		if expr := c.compileFilter(child, negated); expr != nil {
+			exprs = append(exprs, expr)
+		}
+	}
+	return combineFilters(op, exprs)
+}
+
+// filterExpr is a compiled boolean filter prior to rendering as Pinecone JSON.
+// Leaves hold a condition on a single field; branches hold $and or $or.
+type filterExpr struct {
+	op       string
+	field    string
+	cond     map[string]interface{}
+	children []*filterExpr
+}
+
+// combineFilters joins expressions under op, flattening nested groups of the
+// same kind and merging conditions on the same field where that is lossless
+func combineFilters(op string, exprs []*filterExpr) *filterExpr {
+	var flat []*filterExpr
+	for _, expr := range exprs {
+		if expr.op == op {
+			flat = append(flat, expr.children...)
+		} else {
+			flat = append(flat, expr)
+		}
+	}
+
+	var merged []*filterExpr
+	for _, expr := range flat {
+		absorbed := false
+		if expr.op == "" {
+			for _, existing := range merged {
+				if existing.op == "" && existing.field == expr.field && mergeConditions(op, existing.cond, expr.cond) {
+					absorbed = true
+					break
+				}
+			}
+		}
+		if !absorbed {
+			merged = append(merged, expr.clone())
+		}
+	}
+
+	switch len(merged) {
+	case 0:
+		return nil
+	case 1:
+		return merged[0]
+	}
+	return &filterExpr{op: op, children: merged}
+}
+
+// andFilters requires both a and b, either of which may be nil. Unlike
+// combineFilters, it never unions values included on the same field: the
+// typed filters of a request narrow its query text, so lang:en with a typed
+// lang of de matches nothing rather than either language.
+func andFilters(a, b *filterExpr) *filterExpr {
+	if a == nil {
+		return b
+	}
+	if b == nil {
+		return a
+	}
+	for _, x := range a.conjuncts() {
+		for _, y := range b.conjuncts() {
+			if x.op != "" || y.op != "" || x.field != y.field {
+				continue
+			}
+			_, xIncludes := inclusionValues(x.cond)
+			_, yIncludes := inclusionValues(y.cond)
+			if xIncludes && yIncludes {
+				return &filterExpr{op: "$and", children: []*filterExpr{a, b}}
+			}
+		}
+	}
+	return combineFilters("$and", []*filterExpr{a, b})
+}
+
+// conjuncts returns the expressions that e requires
+func (e *filterExpr) conjuncts() []*filterExpr {
+	if e.op == "$and" {
+		return e.children
+	}
+	return []*filterExpr{e}
+}
+
+// clone copies a leaf so merging never mutates a shared condition
+func (e *filterExpr) clone() *filterExpr {
+	if e.op != "" {
+		return e
+	}
+	cond := make(map[string]interface{}, len(e.cond))
+	for k, v := range e.cond {
+		cond[k] = v
+	}
+	return &filterExpr{field: e.field, cond: cond}
+}
+
+// mergeConditions folds cond into dst when both constrain the same field.
+// Under $or, equality conditions union into $in. Under $and, exclusions union
+// into $nin, and equality conditions also union into $in: a post has a single
+// site, language or type, so "site:a.com site:b.com" can only mean either.
+// Range operators on the same field combine under $and when they don't clash.
+func mergeConditions(op string, dst, cond map[string]interface{}) bool {
+	if values, ok := inclusionValues(dst); ok {
+		if more, ok := inclusionValues(cond); ok {
+			delete(dst, "$eq")
+			dst["$in"] = unionValues(values, more)
+			return true
+		}
+	}
+	if op != "$and" {
+		return false
+	}
+	if values, ok := exclusionValues(dst); ok {
+		if more, ok := exclusionValues(cond); ok {
+			delete(dst, "$ne")
+			dst["$nin"] = unionValues(values, more)
+			return true
+		}
+	}
+	for k := range cond {
+		if _, clash := dst[k]; clash || !isRangeOperator(k) {
+			return false
+		}
+	}
+	for k := range dst {
+		if !isRangeOperator(k) {
+			return false
+		}
+	}
+	for k, v := range cond {
+		dst[k] = v
+	}
+	return true
+}
+
+// inclusionValues returns the values of a lone $eq or $in condition
+func inclusionValues(cond map[string]interface{}) ([]interface{}, bool) {
+	if len(cond) != 1 {
+		return nil, false
+	}
+	if v, ok := cond["$eq"]; ok {
+		return []interface{}{v}, true
+	}
+	if v, ok := cond["$in"]; ok {
+		return toInterfaceSlice(v), true
+	}
+	return nil, false
+}
+
+// exclusionValues returns the values of a lone $ne or $nin condition
+func exclusionValues(cond map[string]interface{}) ([]interface{}, bool) {
+	if len(cond) != 1 {
+		return nil, false
+	}
+	if v, ok := cond["$ne"]; ok {
+		return []interface{}{v}, true
+	}
+	if v, ok := cond["$nin"]; ok {
+		return toInterfaceSlice(v), true
+	}
+	return nil, false
+}
+
+// isRangeOperator reports whether op is a numeric comparison
+func isRangeOperator(op string) bool {
+	switch op {
+	case "$gt", "$gte", "$lt", "$lte":
+		return true
+	}
+	return false
+}
+
+// toInterfaceSlice converts the list forms used in conditions to []interface{}
+func toInterfaceSlice(v interface{}) []interface{} {
+	switch vals := v.(type) {
+	case []interface{}:
+		return vals
+	case []string:
+		out := make([]interface{}, len(vals))
+		for i, s := range vals {
+			out[i] = s
+		}
+		return out
+	}
+	return []interface{}{v}
+}
+
+// unionValues appends the values of b missing from a
+func unionValues(a, b []interface{}) []interface{} {
+	out := append([]interface{}{}, a...)
+	for _, v := range b {
+		found := false
+		for _, existing := range out {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// negatedOperators maps each comparison to its complement
+var negatedOperators = map[string]string{
+	"$eq":  "$ne",
+	"$ne":  "$eq",
+	"$in":  "$nin",
+	"$nin": "$in",
+	"$gt":  "$lte",
+	"$lte": "$gt",
+	"$gte": "$lt",
+	"$lt":  "$gte",
+}
+
+// negateCondition returns the complement of a single-field condition. A
+// condition with several comparisons, such as a range, becomes an $or.
+func negateCondition(field string, cond map[string]interface{}) *filterExpr {
+	ops := make([]string, 0, len(cond))
+	for op := range cond {
+		ops = append(ops, op)
+	}
+	sort.Strings(ops)
+
+	var exprs []*filterExpr
+	for _, op := range ops {
+		exprs = append(exprs, &filterExpr{field: field, cond: map[string]interface{}{negatedOperators[op]: cond[op]}})
+	}
+	return combineFilters("$or", exprs)
+}
+
+// render converts the expression into a Pinecone metadata filter. A top-level
+// conjunction of conditions on distinct fields is rendered as a flat map.
+func (e *filterExpr) render() map[string]interface{} {
+	if e.op == "" {
+		return map[string]interface{}{e.field: e.cond}
+	}
+
+	if e.op == "$and" {
+		flat := make(map[string]interface{}, len(e.children))
+		for _, child := range e.children {
+			if _, dup := flat[child.field]; child.op != "" || dup {
+				flat = nil
+				break
+			}
+			flat[child.field] = child.cond
+		}
+		if flat != nil {
+			return flat
+		}
+	}
+
+	children := make([]interface{}, len(e.children))
+	for i, child := range e.children {
+		children[i] = child.render()
+	}
+	return map[string]interface{}{e.op: children}
+}
+
+// corpus returns the corpus being searched, which decides field names
+func (c *queryCompiler) corpus() *Corpus {
+	return corpusFor(c.sq.IsFeedSearch)
+}
+
+// field returns a metadata field name of the corpus being searched, failing
+// if the corpus doesn't have that field
+func (c *queryCompiler) field(name, description string) (string, error) {
+	if name == "" {
+		return "", fmt.Errorf("the %s corpus has no %s field", c.corpus().Name, description)
+	}
+	return name, nil
+}
+
+// compileTypeFilter handles type: (content type, or feeds for the feed index)
+func compileTypeFilter(value string, c *queryCompiler) (string, map[string]interface{}, error) {
+	// Only add rsstype filter for non-feed searches
+	if value == "" || value == "everything" || value == "feeds" {
+		return "", nil, nil
+	}
+	field, err := c.field(c.corpus().Fields.ContentType, "content type")
+	if err != nil {
+		return "", nil, err
+	}
+	return field, map[string]interface{}{"$eq": getTypeMapping(value)}, nil
+}
+
+// compileSiteTypeFilter handles sype: (site type)
+func compileSiteTypeFilter(value string, c *queryCompiler) (string, map[string]interface{}, error) {
+	if value == "" || value == "everything" {
+		return "", nil, nil
+	}
+	field, err := c.field(c.corpus().Fields.SiteType, "site type")
+	if err != nil {
+		return "", nil, err
+	}
+	return field, map[string]interface{}{"$in": getSiteTypeMapping(value)}, nil
+}
+
+// compileOwnerTypeFilter handles oype: (owner type)
+func compileOwnerTypeFilter(value string, c *queryCompiler) (string, map[string]interface{}, error) {
+	if value == "" || value == "everything" {
+		return "", nil, nil
+	}
+	field, err := c.field(c.corpus().Fields.OwnerType, "owner type")
+	if err != nil {
+		return "", nil, err
+	}
+	if value == "individual" {
+		return field, map[string]interface{}{"$eq": value}, nil
+	}
+	return field, map[string]interface{}{"$ne": "individual"}, nil
+}
+
+// compileSinceFilter handles since: (published at or after)
+func compileSinceFilter(value string, c *queryCompiler) (string, map[string]interface{}, error) {
+	start, err := parseTimeBound(value, c.now, false)
+	if err != nil {
+		return "", nil, err
+	}
+	field, err := c.field(c.corpus().Fields.Time, "publish time")
+	if err != nil {
+		return "", nil, err
+	}
+	return field, map[string]interface{}{"$gte": start}, nil
+}
+
+// compileUntilFilter handles until: (published before the end of the period)
+func compileUntilFilter(value string, c *queryCompiler) (string, map[string]interface{}, error) {
+	end, err := parseTimeBound(value, c.now, true)
+	if err != nil {
+		return "", nil, err
+	}
+	field, err := c.field(c.corpus().Fields.Time, "publish time")
+	if err != nil {
+		return "", nil, err
+	}
+	return field, map[string]interface{}{"$lt": end}, nil
+}
+
+// compileBetweenFilter handles between:start..end
+func compileBetweenFilter(value string, c *queryCompiler) (string, map[string]interface{}, error) {
+	cond, err := parseTimeRange(value, c.now)
+	if err != nil {
+		return "", nil, err
+	}
+	field, err := c.field(c.corpus().Fields.Time, "publish time")
+	if err != nil {
+		return "", nil, err
+	}
+	return field, cond, nil
+}
+
+// compileSiteFilter handles site:, whose field name differs between the
+// feeds and content corpora
+func compileSiteFilter(value string, c *queryCompiler) (string, map[string]interface{}, error) {
+	return c.corpus().Fields.BaseURL, map[string]interface{}{"$eq": value}, nil
+}
+
+// compileLangFilter handles lang:
+func compileLangFilter(value string, c *queryCompiler) (string, map[string]interface{}, error) {
+	field, err := c.field(c.corpus().Fields.Lang, "language")
+	if err != nil {
+		return "", nil, err
+	}
+	return field, map[string]interface{}{"$eq": value}, nil
+}
+
+// compileScoreFilter handles score: (minimum quality score)
+func compileScoreFilter(value string, c *queryCompiler) (string, map[string]interface{}, error) {
+	score, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return "", nil, fmt.Errorf("%q is not a number", value)
+	}
+	field, err := c.field(c.corpus().Fields.Quality, "quality score")
+	if err != nil {
+		return "", nil, err
+	}
+	return field, map[string]interface{}{"$gt": score}, nil
+}
+
+// compileLengthFilter handles length: (minimum post length)
+func compileLengthFilter(value string, c *queryCompiler) (string, map[string]interface{}, error) {
+	length, err := strconv.Atoi(value)
+	if err != nil || length < 0 {
+		return "", nil, fmt.Errorf("%q is not a whole number of characters", value)
+	}
+	field, err := c.field(c.corpus().Fields.Length, "length")
+	if err != nil {
+		return "", nil, err
+	}
+	return field, map[string]interface{}{"$gt": length}, nil
+}
+
+// getTypeMapping maps content types to internal values
+func getTypeMapping(t string) string {
+	mapping := map[string]string{
+		"news":     "news",
+		"academic": "academic",
+		"arxiv":    "academic",
+		"papers":   "academic",
+		"journals": "academic",
+		"blog":     "blog",
+		"blogs":    "blog",
+	}
+	if val, ok := mapping[t]; ok {
+		return val
+	}
+	return t
+}
+
+// getSiteTypeMapping maps site types to internal values
+func getSiteTypeMapping(stype string) []string {
+	mapping := map[string][]string{
+		"blog":     {"blog", "individual / personal blog"},
+		"periodic": {"periodic newsletter digest"},
+		"eng":      {"company engineering blog"},
+		"news":     {"news / media publication"},
+	}
+	if val, ok := mapping[stype]; ok {
+		return val
+	}
+	return []string{stype}
+}
+
+// getSinceMapping maps time periods to seconds
+func getSinceMapping(since string) (int64, bool) {
+	mapping := map[string]int64{
+		"yesterday":    24 * 60 * 60,
+		"last_3days":   3 * 24 * 60 * 60,
+		"last_week":    7 * 24 * 60 * 60,
+		"last_month":   30 * 24 * 60 * 60,
+		"last_3months": 3 * 30 * 24 * 60 * 60,
+		"last_year":    365 * 24 * 60 * 60,
+	}
+	val, ok := mapping[since]
+	return val, ok
+}
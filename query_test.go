@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestParseSearchQueryFilters(t *testing.T) {
+	tests := []struct {
+		query   string
+		text    string
+		filters string
+	}{
+		{`rust lang:en`, "rust", `{"lang":{"$eq":"en"}}`},
+		{`site:a.com site:b.com`, "", `{"base_url":{"$in":["a.com","b.com"]}}`},
+		{`lang:en OR lang:de`, "", `{"lang":{"$in":["en","de"]}}`},
+		{`-lang:en -lang:de`, "", `{"lang":{"$nin":["en","de"]}}`},
+		{`-(lang:en site:a.com)`, "", `{"$or":[{"lang":{"$ne":"en"}},{"base_url":{"$ne":"a.com"}}]}`},
+		{`rust (site:a.com OR site:b.com) -lang:de`, "rust", `{"base_url":{"$in":["a.com","b.com"]},"lang":{"$ne":"de"}}`},
+		{`(site:a.com OR lang:en) -(type:blogs OR type:news)`, "", `{"$and":[{"$or":[{"base_url":{"$eq":"a.com"}},{"lang":{"$eq":"en"}}]},{"rsstype":{"$nin":["blog","news"]}}]}`},
+		{`between:2024-01-01..2024-02-01`, "", `{"unix_time":{"$gte":1704067200,"$lt":1706832000}}`},
+		{`-fno-rtti flags`, "-fno-rtti flags", `{}`},
+	}
+	for _, tt := range tests {
+		sq, err := parseSearchQuery(tt.query)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.query, err)
+			continue
+		}
+		if sq.Text != tt.text {
+			t.Errorf("%q: text = %q, want %q", tt.query, sq.Text, tt.text)
+		}
+		filters, _ := json.Marshal(sq.Filters)
+		if string(filters) != tt.filters {
+			t.Errorf("%q: filters = %s, want %s", tt.query, filters, tt.filters)
+		}
+	}
+}
+
+func TestParseSearchQueryTerms(t *testing.T) {
+	sq, err := parseSearchQuery(`"exact phrase" go`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sq.Text != "exact phrase go" || !reflect.DeepEqual(sq.Phrases, []string{"exact phrase"}) {
+		t.Errorf("text = %q, phrases = %q", sq.Text, sq.Phrases)
+	}
+
+	sq, err = parseSearchQuery(`rust <game>:0.5`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sq.Text != "rust" || sq.Negation != "game" || sq.NegationWeight != 0.5 {
+		t.Errorf("text = %q, negation = %q:%v", sq.Text, sq.Negation, sq.NegationWeight)
+	}
+
+	sq, err = parseSearchQuery(`type:feeds rust`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sq.IsFeedSearch || sq.Text != "rust" {
+		t.Errorf("feed search = %v, text = %q", sq.IsFeedSearch, sq.Text)
+	}
+}
+
+// An excluded phrase steers away from it like <phrase>, rather than being
+// embedded with the rest of the text
+func TestParseSearchQueryExcludedPhrase(t *testing.T) {
+	sq, err := parseSearchQuery(`rust -"game engine"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sq.Text != "rust" || sq.Negation != "game engine" {
+		t.Errorf("text = %q, negation = %q", sq.Text, sq.Negation)
+	}
+
+	sq, err = parseSearchQuery(`-(-"x")`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sq.Text != "x" || sq.Negation != "" {
+		t.Errorf("double negation: text = %q, negation = %q", sq.Text, sq.Negation)
+	}
+}
+
+func TestParseSearchQueryErrors(t *testing.T) {
+	tests := []struct {
+		query    string
+		operator string
+		offsets  []int
+	}{
+		{`since:lastweek`, "since", []int{0}},
+		{`x (lang:en`, "", []int{2}},
+		{`café (lang:en`, "", []int{5}},
+		{`-(rust) lang:en`, "", []int{2}},
+		{`rust OR`, "", []int{5}},
+		{`lang:`, "lang", []int{0}},
+		{`<a> <b>`, "", []int{4}},
+		{`-sort:date`, "sort", []int{1}},
+		{`lang:en OR sort:date`, "sort", []int{11}},
+		{`score:>5 score:<9`, "score", []int{0, 9}},
+		{`between:2024-01-01,2024-02-01`, "between", []int{0}},
+	}
+	for _, tt := range tests {
+		_, err := parseSearchQuery(tt.query)
+		var errs QueryErrors
+		if !errors.As(err, &errs) {
+			t.Errorf("%q: error = %v, want QueryErrors", tt.query, err)
+			continue
+		}
+		var offsets []int
+		for _, e := range errs {
+			offsets = append(offsets, e.Offset)
+			if e.Operator != tt.operator {
+				t.Errorf("%q: operator = %q, want %q", tt.query, e.Operator, tt.operator)
+			}
+		}
+		if !reflect.DeepEqual(offsets, tt.offsets) {
+			t.Errorf("%q: offsets = %v, want %v (%v)", tt.query, offsets, tt.offsets, err)
+		}
+	}
+}
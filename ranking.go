@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+)
+
+// rankProfile weights the signals blended into a result's rank score. Each
+// signal is scaled to 0–1 before weighting:
+//   - relevance: the vector (or fused) score relative to the best result
+//   - freshness: halves every halfLife since publication
+//   - quality: the score metadata
+//   - length: saturates as posts grow past lengthMidpoint characters
+type rankProfile struct {
+	relevance float64
+	freshness float64
+	quality   float64
+	length    float64
+	halfLife  time.Duration
+}
+
+// defaultRankProfile keeps Pinecone's ordering
+const defaultRankProfile = "relevance"
+
+// lengthMidpoint is the post length that earns half of the length signal
+const lengthMidpoint = 3000
+
+// rankProfiles lists the profiles selectable with rank:
+var rankProfiles = map[string]rankProfile{
+	"relevance": {relevance: 1},
+	"balanced":  {relevance: 0.6, freshness: 0.2, quality: 0.15, length: 0.05, halfLife: 90 * 24 * time.Hour},
+	"fresh":     {relevance: 0.5, freshness: 0.4, quality: 0.1, halfLife: 7 * 24 * time.Hour},
+	"quality":   {relevance: 0.5, freshness: 0.05, quality: 0.35, length: 0.1, halfLife: 365 * 24 * time.Hour},
+	"longform":  {relevance: 0.55, quality: 0.15, length: 0.3},
+}
+
+// parseRankProfile validates a rank: value
+func parseRankProfile(value string) (string, error) {
+	name := strings.ToLower(value)
+	if _, ok := rankProfiles[name]; !ok {
+		names := make([]string, 0, len(rankProfiles))
+		for n := range rankProfiles {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return "", fmt.Errorf("unknown rank profile %q (expected %s)", value, strings.Join(names, ", "))
+	}
+	return name, nil
+}
+
+// rankResults scores results with the named profile and orders them by that
+// score. The relevance profile leaves results untouched.
+func rankResults(results []SearchResult, profileName string, now time.Time) {
+	profile, ok := rankProfiles[profileName]
+	if !ok || profileName == defaultRankProfile || len(results) == 0 {
+		return
+	}
+
+	maxScore := 0.0
+	for _, result := range results {
+		maxScore = math.Max(maxScore, result.Score)
+	}
+
+	for i := range results {
+		r := &results[i]
+		rank := 0.0
+		if maxScore > 0 {
+			rank += profile.relevance * math.Max(r.Score, 0) / maxScore
+		}
+		if published := r.publishedTime(); profile.halfLife > 0 && !published.IsZero() {
+			age := math.Max(now.Sub(published).Hours(), 0)
+			rank += profile.freshness * math.Pow(0.5, age/profile.halfLife.Hours())
+		}
+		rank += profile.quality * math.Min(math.Max(r.quality, 0), 1)
+		if r.Length > 0 {
+			rank += profile.length * float64(r.Length) / float64(r.Length+lengthMidpoint)
+		}
+		r.RankScore = rank
+	}
+
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].RankScore > results[j].RankScore
+	})
+}
+
+// rankedScore returns the rank score when a profile was applied, and the
+// vector score otherwise
+func (r *SearchResult) rankedScore() float64 {
+	if r.RankScore != 0 {
+		return r.RankScore
+	}
+	return r.Score
+}
@@ -0,0 +1,285 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultSearchLimit is the number of results returned when none is requested
+const defaultSearchLimit = 50
+
+// Number of latest posts fetched for each feed with include_posts
+const (
+	defaultLatestPosts = 1
+	maxLatestPosts     = 10
+)
+
+// SearchRequest describes a search independently of how it arrived. The URL
+// query string, a JSON POST body and custom RSS workflow nodes all build one.
+// Text may use the full query language; Filters are ANDed with any filters
+// the text contains.
+type SearchRequest struct {
+	Text         string        `json:"text"`
+	Filters      SearchFilters `json:"filters"`
+	Namespace    string        `json:"namespace,omitempty"` // "posts" (default), "feeds" or "all"
+	Sort         []string      `json:"sort,omitempty"`      // e.g. ["-date", "score"]
+	Rank         string        `json:"rank,omitempty"`      // rank profile, e.g. "fresh"
+	Limit        int           `json:"limit,omitempty"`
+	Offset       int           `json:"offset,omitempty"`
+	Cursor       string        `json:"cursor,omitempty"` // opaque; overrides Offset and Limit
+	IncludePosts bool          `json:"include_posts,omitempty"`
+	LatestPosts  int           `json:"latest_posts,omitempty"` // posts per feed with include_posts, default 1
+	Facets       bool          `json:"facets,omitempty"`       // count candidates by domain, lang, type and month
+	Clusters     int           `json:"clusters,omitempty"`     // group the page into this many topics
+
+	// paramErrs records URL parameters that couldn't be converted
+	paramErrs []*QueryError
+	// defaultPerDomain caps posts per site unless the query sets perdomain:
+	defaultPerDomain int
+	// rerank is set when a reranker reorders the results of search text
+	rerank bool
+}
+
+// SearchFilters are typed metadata filters. Each list matches any of its
+// values, and all of the filters that are set must match.
+type SearchFilters struct {
+	Content   []string `json:"content,omitempty"`   // content type, as in type:
+	SiteType  []string `json:"site_type,omitempty"` // site type, as in sype:
+	OwnerType string   `json:"owner_type,omitempty"`
+	Sites     []string `json:"sites,omitempty"`
+	Langs     []string `json:"langs,omitempty"`
+	Since     string   `json:"since,omitempty"`
+	Until     string   `json:"until,omitempty"`
+	MinScore  *float64 `json:"min_score,omitempty"`
+	MinLength *int     `json:"min_length,omitempty"`
+}
+
+// searchRequestFromHTTP builds a SearchRequest from a JSON POST body, or from
+// the URL query string for any other request
+func searchRequestFromHTTP(r *http.Request) (*SearchRequest, error) {
+	if r.Method == http.MethodPost && strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		var req SearchRequest
+		decoder := json.NewDecoder(r.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&req); err != nil {
+			return nil, fmt.Errorf("invalid JSON body: %w", err)
+		}
+		return &req, nil
+	}
+	return searchRequestFromParams(r.URL.Query()), nil
+}
+
+// searchRequestFromParams builds a SearchRequest from URL query parameters
+// as sent by the search page: qry, type, content, time, sort, rank,
+// include_posts, latest_posts, facets, clusters, limit, offset and cursor
+func searchRequestFromParams(params map[string][]string) *SearchRequest {
+	req := &SearchRequest{
+		Text:         getParam(params, "qry"),
+		Rank:         getParam(params, "rank"),
+		Cursor:       getParam(params, "cursor"),
+		IncludePosts: getParam(params, "include_posts") == "true",
+		Facets:       getParam(params, "facets") == "true",
+	}
+	req.Limit = req.intParam(params, "limit")
+	req.Offset = req.intParam(params, "offset")
+	req.LatestPosts = req.intParam(params, "latest_posts")
+	req.Clusters = req.intParam(params, "clusters")
+
+	switch getParam(params, "type") {
+	case "sites":
+		req.Namespace = "feeds"
+	case "all":
+		req.Namespace = namespaceAll
+		fallthrough
+	default:
+		if content := getParam(params, "content"); content != "" {
+			req.Filters.Content = []string{content}
+		}
+		// Add time filter only if explicitly specified
+		if timeFilter := getParam(params, "time"); timeFilter != "" {
+			req.Filters.Since, req.Filters.Until = timeParamBounds(timeFilter)
+		}
+	}
+
+	if sortParam := getParam(params, "sort"); sortParam != "" {
+		req.Sort = strings.Split(sortParam, ",")
+	}
+	return req
+}
+
+// intParam reads an optional integer URL parameter
+func (req *SearchRequest) intParam(params map[string][]string, key string) int {
+	value := getParam(params, key)
+	if value == "" {
+		return 0
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		req.paramErrs = append(req.paramErrs, &QueryError{Field: key, Message: fmt.Sprintf("%q is not a whole number", value)})
+	}
+	return n
+}
+
+// latestPosts returns the number of latest posts to fetch per feed
+func (req *SearchRequest) latestPosts() int {
+	switch {
+	case req.LatestPosts <= 0:
+		return defaultLatestPosts
+	case req.LatestPosts > maxLatestPosts:
+		return maxLatestPosts
+	}
+	return req.LatestPosts
+}
+
+// limit returns the requested number of results or the default
+func (req *SearchRequest) limit() int {
+	if req.Limit <= 0 {
+		return defaultSearchLimit
+	}
+	return req.Limit
+}
+
+// parse compiles the request into a SearchQuery, combining the filters in
+// its text with its typed filters, and resolves any cursor into Offset and
+// Limit. All problems are returned as QueryErrors.
+func (req *SearchRequest) parse() (SearchQuery, error) {
+	sq := SearchQuery{
+		Filters: make(map[string]interface{}),
+	}
+
+	root, err := parseQuerySyntax(req.Text)
+	if err != nil {
+		return sq, err
+	}
+
+	c := &queryCompiler{sq: &sq, now: time.Now(), errs: req.paramErrs}
+	switch req.Namespace {
+	case "", "posts":
+	case "feeds":
+		sq.IsFeedSearch = true
+	default:
+		c.errs = append(c.errs, &QueryError{Field: "namespace", Message: fmt.Sprintf("unknown namespace %q (expected posts, feeds or all)", req.Namespace)})
+	}
+
+	textExpr := c.compile(root)
+	if req.Namespace == "posts" && sq.IsFeedSearch {
+		c.errs = append(c.errs, &QueryError{Field: "namespace", Message: "type:feeds in the query conflicts with namespace posts"})
+	}
+	typedExpr := combineFilters("$and", req.Filters.compile(c))
+	if expr := andFilters(textExpr, typedExpr); expr != nil {
+		sq.Filters = expr.render()
+	}
+
+	// A sort in the query text takes precedence over the request's sort
+	if len(sq.Sort) == 0 && len(req.Sort) > 0 {
+		keys, err := parseSortKeys(strings.Join(req.Sort, ","))
+		if err != nil {
+			c.errs = append(c.errs, &QueryError{Field: "sort", Message: err.Error()})
+		}
+		sq.Sort = keys
+	}
+
+	// Likewise a rank: in the query text overrides the request's profile
+	if sq.Rank == "" && req.Rank != "" {
+		name, err := parseRankProfile(req.Rank)
+		if err != nil {
+			c.errs = append(c.errs, &QueryError{Field: "rank", Message: err.Error()})
+		}
+		sq.Rank = name
+	}
+	if sq.Rank == "" {
+		sq.Rank = defaultRankProfile
+	}
+
+	if sq.Mode == "" {
+		sq.Mode = searchModeVector
+	}
+	if sq.PerDomain == nil && req.defaultPerDomain > 0 {
+		perDomain := req.defaultPerDomain
+		sq.PerDomain = &perDomain
+	}
+	if sq.Mode != searchModeVector && len(tokenize(sq.Text)) == 0 {
+		offset := strings.LastIndex(req.Text, "mode:")
+		c.errs = append(c.errs, &QueryError{Operator: "mode", Offset: offset, Message: fmt.Sprintf("mode:%s needs search text", sq.Mode)})
+	}
+
+	if req.Clusters != 0 && (req.Clusters < minClusters || req.Clusters > maxClusters) {
+		c.errs = append(c.errs, &QueryError{Field: "clusters", Message: fmt.Sprintf("must be from %d to %d", minClusters, maxClusters)})
+	}
+	sq.IncludeValues = req.Clusters > 0
+	sq.Reranked = req.rerank && sq.Text != ""
+
+	req.resolvePage(c)
+
+	if sq.Text == "" && !sq.IsLike && len(sq.Filters) == 0 && len(c.errs) == 0 {
+		c.errs = append(c.errs, &QueryError{Offset: 0, Message: "query has no search text, filters or like: target"})
+	}
+
+	if len(c.errs) > 0 {
+		return sq, queryErrorsAt(req.Text, c.errs...)
+	}
+	return sq, nil
+}
+
+// compile converts the typed filters into filter expressions using the same
+// operator definitions as the query language
+func (f *SearchFilters) compile(c *queryCompiler) []*filterExpr {
+	var exprs []*filterExpr
+	anyOf := func(field, operator string, values []string) {
+		var alternatives []*filterExpr
+		for _, value := range values {
+			if expr := c.compileField(field, operator, value); expr != nil {
+				alternatives = append(alternatives, expr)
+			}
+		}
+		if expr := combineFilters("$or", alternatives); expr != nil {
+			exprs = append(exprs, expr)
+		}
+	}
+
+	anyOf("filters.content", "type", f.Content)
+	anyOf("filters.site_type", "sype", f.SiteType)
+	anyOf("filters.sites", "site", f.Sites)
+	anyOf("filters.langs", "lang", f.Langs)
+	if f.OwnerType != "" {
+		anyOf("filters.owner_type", "oype", []string{f.OwnerType})
+	}
+	if f.Since != "" {
+		anyOf("filters.since", "since", []string{f.Since})
+	}
+	if f.Until != "" {
+		anyOf("filters.until", "until", []string{f.Until})
+	}
+	if f.MinScore != nil {
+		anyOf("filters.min_score", "score", []string{strconv.FormatFloat(*f.MinScore, 'f', -1, 64)})
+	}
+	if f.MinLength != nil {
+		anyOf("filters.min_length", "length", []string{strconv.Itoa(*f.MinLength)})
+	}
+	return exprs
+}
+
+// compileField compiles a typed filter value with the named operator,
+// recording any error against the request field
+func (c *queryCompiler) compileField(field, operator, value string) *filterExpr {
+	if value == "" {
+		c.errs = append(c.errs, &QueryError{Field: field, Message: "empty value"})
+		return nil
+	}
+	if operator == "site" {
+		c.sq.HasSiteFilter = true
+	}
+	name, cond, err := queryOperators[operator].filter(value, c)
+	if err != nil {
+		c.errs = append(c.errs, &QueryError{Field: field, Message: err.Error()})
+		return nil
+	}
+	if name == "" || len(cond) == 0 {
+		return nil
+	}
+	return &filterExpr{field: name, cond: cond}
+}
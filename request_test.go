@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// queryErrorFields returns the fields or operators of the QueryErrors in err
+func queryErrorFields(err error) []string {
+	var queryErrs QueryErrors
+	if !errors.As(err, &queryErrs) {
+		return nil
+	}
+	var fields []string
+	for _, queryErr := range queryErrs {
+		fields = append(fields, queryErr.Field+queryErr.Operator)
+	}
+	return fields
+}
+
+func TestSearchRequestFromJSON(t *testing.T) {
+	body := `{"text": "local-first", "namespace": "posts", "filters": {"sites": ["a.com"], "langs": ["en"], "min_length": 1000},
+		"sort": ["-date"], "rank": "fresh", "limit": 20, "facets": true}`
+	r := httptest.NewRequest("POST", "/api/search?qry=ignored", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json; charset=utf-8")
+	req, err := searchRequestFromHTTP(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	minLength := 1000
+	want := &SearchRequest{
+		Text:      "local-first",
+		Namespace: "posts",
+		Filters:   SearchFilters{Sites: []string{"a.com"}, Langs: []string{"en"}, MinLength: &minLength},
+		Sort:      []string{"-date"},
+		Rank:      "fresh",
+		Limit:     20,
+		Facets:    true,
+	}
+	if !reflect.DeepEqual(req, want) {
+		t.Errorf("request %+v, want %+v", req, want)
+	}
+}
+
+func TestSearchRequestFromJSONRejects(t *testing.T) {
+	for _, body := range []string{
+		`{"text": "rust", "filter": {"langs": ["en"]}}`,
+		`{"text": "rust", "filters": {"language": "en"}}`,
+		`{"text": "rust", "limit": "ten"}`,
+		`{"text": `,
+	} {
+		r := httptest.NewRequest("POST", "/api/search", strings.NewReader(body))
+		r.Header.Set("Content-Type", "application/json")
+		if _, err := searchRequestFromHTTP(r); err == nil {
+			t.Errorf("%s: no error", body)
+		}
+	}
+}
+
+func TestSearchRequestFromParams(t *testing.T) {
+	// A POST without a JSON body is read from the URL like a GET
+	r := httptest.NewRequest("POST", "/api/search?qry=rust&type=sites&limit=abc&sort=-date,score", nil)
+	req, err := searchRequestFromHTTP(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Text != "rust" || req.Namespace != "feeds" || !reflect.DeepEqual(req.Sort, []string{"-date", "score"}) {
+		t.Errorf("request %+v", req)
+	}
+	if _, err := req.parse(); !reflect.DeepEqual(queryErrorFields(err), []string{"limit"}) {
+		t.Errorf("limit=abc: error %v, want one for limit", err)
+	}
+}
+
+func TestSearchFiltersCombineWithText(t *testing.T) {
+	minLength := 1000
+	tests := []struct {
+		name    string
+		req     SearchRequest
+		filters string
+	}{
+		{"typed filters alone", SearchRequest{Filters: SearchFilters{Sites: []string{"a.com", "b.com"}, Content: []string{"blogs"}}},
+			`{"base_url":{"$in":["a.com","b.com"]},"rsstype":{"$eq":"blog"}}`},
+		{"different fields", SearchRequest{Text: "rust lang:en", Filters: SearchFilters{Sites: []string{"a.com"}, MinLength: &minLength}},
+			`{"base_url":{"$eq":"a.com"},"lang":{"$eq":"en"},"length":{"$gt":1000}}`},
+		{"same field narrows", SearchRequest{Text: "rust lang:en", Filters: SearchFilters{Langs: []string{"de"}}},
+			`{"$and":[{"lang":{"$eq":"en"}},{"lang":{"$eq":"de"}}]}`},
+		{"alternatives in the text", SearchRequest{Text: "site:a.com OR site:b.com", Filters: SearchFilters{Sites: []string{"b.com", "c.com"}}},
+			`{"$and":[{"base_url":{"$in":["a.com","b.com"]}},{"base_url":{"$in":["b.com","c.com"]}}]}`},
+		{"exclusion and inclusion", SearchRequest{Text: "-lang:de", Filters: SearchFilters{Langs: []string{"en"}}},
+			`{"$and":[{"lang":{"$ne":"de"}},{"lang":{"$eq":"en"}}]}`},
+	}
+	for _, tt := range tests {
+		sq, err := tt.req.parse()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		filters, _ := json.Marshal(sq.Filters)
+		if string(filters) != tt.filters {
+			t.Errorf("%s: filters = %s, want %s", tt.name, filters, tt.filters)
+		}
+	}
+}
+
+func TestSearchRequestErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		req    SearchRequest
+		fields []string
+	}{
+		{"unknown namespace", SearchRequest{Text: "rust", Namespace: "blogs"}, []string{"namespace"}},
+		{"type:feeds in a posts search", SearchRequest{Text: "rust type:feeds", Namespace: "posts"}, []string{"namespace"}},
+		{"empty typed value", SearchRequest{Text: "rust", Filters: SearchFilters{Langs: []string{""}}}, []string{"filters.langs"}},
+		{"unparseable typed time", SearchRequest{Text: "rust", Filters: SearchFilters{Since: "lastweek"}}, []string{"filters.since"}},
+		{"unknown sort", SearchRequest{Text: "rust", Sort: []string{"-popularity"}}, []string{"sort"}},
+		{"nothing to search", SearchRequest{}, []string{""}},
+	}
+	for _, tt := range tests {
+		_, err := tt.req.parse()
+		if got := queryErrorFields(err); !reflect.DeepEqual(got, tt.fields) {
+			t.Errorf("%s: error %v, want errors for %q", tt.name, err, tt.fields)
+		}
+	}
+
+	// type:feeds with no namespace, or namespace feeds, is a feed search
+	for _, namespace := range []string{"", "feeds"} {
+		req := SearchRequest{Text: "rust type:feeds", Namespace: namespace}
+		if sq, err := req.parse(); err != nil || !sq.IsFeedSearch {
+			t.Errorf("namespace %q: feed search %v, error %v", namespace, sq.IsFeedSearch, err)
+		}
+	}
+}
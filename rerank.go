@@ -0,0 +1,197 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+)
+
+// Rerank client defaults
+const (
+	defaultRerankURL        = "https://api.voyageai.com/v1/rerank"
+	defaultRerankModel      = "rerank-2"
+	defaultRerankCandidates = 200
+)
+
+// Reranker reorders the candidates found by vector retrieval. Rerank returns
+// the topN most relevant documents as indexes into documents with their
+// relevance scores, best first. A nil result keeps the retrieval order.
+type Reranker interface {
+	Rerank(ctx context.Context, query string, documents []string, topN int) ([]RerankResult, error)
+	// Candidates returns how many candidates to retrieve to rerank to topN
+	Candidates(topN int) int
+}
+
+// RerankResult is the relevance of one document to the query
+type RerankResult struct {
+	Index int     `json:"index"`
+	Score float64 `json:"relevance_score"`
+}
+
+// noopReranker keeps the retrieval order. It is the default reranker.
+type noopReranker struct{}
+
+func (noopReranker) Rerank(ctx context.Context, query string, documents []string, topN int) ([]RerankResult, error) {
+	return nil, nil
+}
+
+func (noopReranker) Candidates(topN int) int {
+	return topN
+}
+
+// reranks reports whether a reranker other than the default is configured
+func (app *App) reranks() bool {
+	_, noop := app.reranker.(noopReranker)
+	return !noop
+}
+
+// RerankClient calls a cross-encoder rerank API with the request and
+// response shape of Voyage's /v1/rerank. The endpoint is configurable so a
+// compatible or local server can stand in for Voyage.
+type RerankClient struct {
+	apiKey     string
+	endpoint   string
+	model      string
+	candidates int
+	client     *http.Client
+}
+
+type RerankRequest struct {
+	Query     string   `json:"query"`
+	Documents []string `json:"documents"`
+	Model     string   `json:"model"`
+	TopK      int      `json:"top_k,omitempty"`
+}
+
+type RerankResponse struct {
+	Data  []RerankResult `json:"data"`
+	Model string         `json:"model"`
+	Usage struct {
+		TotalTokens int `json:"total_tokens"`
+	} `json:"usage"`
+}
+
+func NewRerankClient(apiKey, endpoint, model string, candidates int) *RerankClient {
+	return &RerankClient{
+		apiKey:     apiKey,
+		endpoint:   endpoint,
+		model:      model,
+		candidates: candidates,
+		// Deadlines come from the context of each call
+		client: newRetryingClient("rerank"),
+	}
+}
+
+// Candidates widens retrieval to the configured pool, within the search
+// window limit
+func (rc *RerankClient) Candidates(topN int) int {
+	if topN >= rc.candidates {
+		return topN
+	}
+	if rc.candidates > maxSearchWindow {
+		return maxSearchWindow
+	}
+	return rc.candidates
+}
+
+func (rc *RerankClient) Rerank(ctx context.Context, query string, documents []string, topN int) ([]RerankResult, error) {
+	if len(documents) == 0 {
+		return []RerankResult{}, nil
+	}
+
+	// Build request
+	reqBody := RerankRequest{
+		Query:     query,
+		Documents: documents,
+		Model:     rc.model,
+		TopK:      topN,
+	}
+
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Make HTTP request
+	req, err := http.NewRequestWithContext(ctx, "POST", rc.endpoint, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	// Reranking has no side effects, so it is safe to retry
+	markIdempotent(req)
+	req.Header.Set("Authorization", "Bearer "+rc.apiKey)
+
+	resp, err := rc.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to make request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, newAPIError("rerank API", resp)
+	}
+
+	// Parse response
+	var response RerankResponse
+	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	for _, result := range response.Data {
+		if result.Index < 0 || result.Index >= len(documents) {
+			return nil, fmt.Errorf("invalid index %d in response", result.Index)
+		}
+	}
+	return response.Data, nil
+}
+
+// rerankResults reorders results with the reranker and keeps the topN most
+// relevant, replacing their scores with the reranker's. When the reranker
+// fails or keeps the order, the first topN results are kept as retrieved.
+// It reports whether the results were reranked.
+func (app *App) rerankResults(ctx context.Context, query string, results []SearchResult, topN int) ([]SearchResult, bool) {
+	if query == "" || len(results) == 0 {
+		return truncateResults(results, topN), false
+	}
+
+	documents := make([]string, len(results))
+	for i := range results {
+		documents[i] = results[i].Title + "\n" + results[i].Subtitle
+	}
+	ctx, cancel := context.WithTimeout(ctx, app.timeouts.Rerank)
+	defer cancel()
+	ranked, err := app.reranker.Rerank(ctx, query, documents, topN)
+	if err != nil {
+		log.Printf("Rerank error: %v", err)
+		return truncateResults(results, topN), false
+	}
+	if ranked == nil {
+		return truncateResults(results, topN), false
+	}
+
+	reranked := make([]SearchResult, 0, len(ranked))
+	seen := make(map[int]bool, len(ranked))
+	for _, r := range ranked {
+		if seen[r.Index] {
+			continue
+		}
+		seen[r.Index] = true
+		result := results[r.Index]
+		result.Score = r.Score
+		reranked = append(reranked, result)
+	}
+	return truncateResults(reranked, topN), true
+}
+
+// truncateResults keeps at most n results
+func truncateResults(results []SearchResult, n int) []SearchResult {
+	if len(results) > n {
+		return results[:n]
+	}
+	return results
+}
@@ -0,0 +1,192 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// rerankServer answers rerank requests with data, recording the last request
+func rerankServer(t *testing.T, status int, data []RerankResult) (*httptest.Server, *RerankRequest) {
+	var last RerankRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("Authorization header %q", r.Header.Get("Authorization"))
+		}
+		if err := json.NewDecoder(r.Body).Decode(&last); err != nil {
+			t.Errorf("decoding rerank request: %v", err)
+		}
+		if status != http.StatusOK {
+			http.Error(w, "rerank failed", status)
+			return
+		}
+		json.NewEncoder(w).Encode(RerankResponse{Data: data, Model: last.Model})
+	}))
+	t.Cleanup(server.Close)
+	return server, &last
+}
+
+func rerankTestApp(server *httptest.Server) *App {
+	return &App{
+		reranker: NewRerankClient("key", server.URL, "rerank-test", 10),
+		timeouts: defaultStageTimeouts,
+	}
+}
+
+func rerankCandidates() []SearchResult {
+	return []SearchResult{
+		{URL: "a", Title: "A", Subtitle: "first", Score: 0.9},
+		{URL: "b", Title: "B", Subtitle: "second", Score: 0.8},
+		{URL: "c", Title: "C", Subtitle: "third", Score: 0.7},
+		{URL: "d", Title: "D", Subtitle: "fourth", Score: 0.6},
+	}
+}
+
+func resultURLs(results []SearchResult) []string {
+	urls := make([]string, len(results))
+	for i, result := range results {
+		urls[i] = result.URL
+	}
+	return urls
+}
+
+func TestRerankReorders(t *testing.T) {
+	server, last := rerankServer(t, http.StatusOK, []RerankResult{{Index: 2, Score: 0.95}, {Index: 0, Score: 0.5}})
+	app := rerankTestApp(server)
+
+	results, reranked := app.rerankResults(context.Background(), "query", rerankCandidates(), 2)
+	if !reranked || !reflect.DeepEqual(resultURLs(results), []string{"c", "a"}) {
+		t.Fatalf("reranked %v, results %v", reranked, resultURLs(results))
+	}
+	if results[0].Score != 0.95 {
+		t.Errorf("score %v, want the reranker's 0.95", results[0].Score)
+	}
+	if last.Query != "query" || last.Model != "rerank-test" || last.TopK != 2 || last.Documents[1] != "B\nsecond" {
+		t.Errorf("request %+v", *last)
+	}
+}
+
+func TestRerankTruncates(t *testing.T) {
+	// The server ignores top_k and ranks every document
+	server, _ := rerankServer(t, http.StatusOK, []RerankResult{{Index: 3, Score: 0.9}, {Index: 1, Score: 0.8}, {Index: 1, Score: 0.8}, {Index: 0, Score: 0.1}})
+	app := rerankTestApp(server)
+
+	results, reranked := app.rerankResults(context.Background(), "query", rerankCandidates(), 2)
+	if !reranked || !reflect.DeepEqual(resultURLs(results), []string{"d", "b"}) {
+		t.Errorf("reranked %v, results %v", reranked, resultURLs(results))
+	}
+
+	// Duplicate indexes are dropped before truncating
+	results, _ = app.rerankResults(context.Background(), "query", rerankCandidates(), 3)
+	if !reflect.DeepEqual(resultURLs(results), []string{"d", "b", "a"}) {
+		t.Errorf("results %v", resultURLs(results))
+	}
+}
+
+func TestRerankFallsBack(t *testing.T) {
+	useRetryPolicy(t, RetryPolicy{MaxAttempts: 1})
+	tests := []struct {
+		name   string
+		status int
+		data   []RerankResult
+	}{
+		{"invalid index", http.StatusOK, []RerankResult{{Index: 0, Score: 0.9}, {Index: 7, Score: 0.8}}},
+		{"negative index", http.StatusOK, []RerankResult{{Index: -1, Score: 0.9}}},
+		{"server error", http.StatusInternalServerError, nil},
+		{"client error", http.StatusUnauthorized, nil},
+	}
+	for _, tt := range tests {
+		server, _ := rerankServer(t, tt.status, tt.data)
+		app := rerankTestApp(server)
+
+		results, reranked := app.rerankResults(context.Background(), "query", rerankCandidates(), 3)
+		if reranked || !reflect.DeepEqual(resultURLs(results), []string{"a", "b", "c"}) {
+			t.Errorf("%s: reranked %v, results %v, want the first 3 as retrieved", tt.name, reranked, resultURLs(results))
+		}
+		if results[0].Score != 0.9 {
+			t.Errorf("%s: score %v, want the retrieval score", tt.name, results[0].Score)
+		}
+	}
+}
+
+func TestRerankCandidates(t *testing.T) {
+	client := NewRerankClient("key", defaultRerankURL, defaultRerankModel, 200)
+	if got := client.Candidates(50); got != 200 {
+		t.Errorf("Candidates(50) = %d, want the configured 200", got)
+	}
+	if got := client.Candidates(300); got != 300 {
+		t.Errorf("Candidates(300) = %d, want 300", got)
+	}
+	client = NewRerankClient("key", defaultRerankURL, defaultRerankModel, 5000)
+	if got := client.Candidates(50); got != maxSearchWindow {
+		t.Errorf("Candidates(50) = %d, want the window limit %d", got, maxSearchWindow)
+	}
+}
+
+// hashReranker scores each document by a hash of its text, so its order
+// over a pool changes whenever the pool does. Like RerankClient, it asks for
+// at least pool candidates.
+type hashReranker struct {
+	pool int
+}
+
+func (r hashReranker) Rerank(ctx context.Context, query string, documents []string, topN int) ([]RerankResult, error) {
+	ranked := make([]RerankResult, len(documents))
+	for i, document := range documents {
+		h := fnv.New32a()
+		h.Write([]byte(document))
+		ranked[i] = RerankResult{Index: i, Score: float64(h.Sum32()) / (1 << 32)}
+	}
+	sort.Slice(ranked, func(i, j int) bool { return ranked[i].Score > ranked[j].Score })
+	if len(ranked) > topN {
+		ranked = ranked[:topN]
+	}
+	return ranked, nil
+}
+
+func (r hashReranker) Candidates(topN int) int {
+	if topN > r.pool {
+		return topN
+	}
+	return r.pool
+}
+
+// Pages reranked past the reranker's own pool are still cut from one order
+func TestRerankedPagesShareOnePool(t *testing.T) {
+	app := searchTestApp(t, pineconeCorpus)
+	app.reranker = hashReranker{pool: 20}
+	search := func(offset, limit int) []string {
+		req := &SearchRequest{Text: "rust", Offset: offset, Limit: limit}
+		response, err := app.performSearch(context.Background(), req)
+		if err != nil {
+			t.Fatalf("offset %d: %v", offset, err)
+		}
+		return resultURLs(response.Results)
+	}
+
+	whole := search(0, 50)
+	var paged []string
+	for offset := 0; offset < 50; offset += 10 {
+		paged = append(paged, search(offset, 10)...)
+	}
+	if strings.Join(paged, " ") != strings.Join(whole, " ") {
+		t.Errorf("pages of 10 differ from a page of 50:\n%v\n%v", paged, whole)
+	}
+
+	// Without search text nothing is reranked, so only the wider window
+	// limits paging
+	var queryErrs QueryErrors
+	if _, err := app.performSearch(context.Background(), &SearchRequest{Text: "lang:en", Offset: reorderWindow, Limit: 10}); errors.As(err, &queryErrs) {
+		t.Errorf("filter-only search past the reranked pool: %v", err)
+	}
+	if _, err := app.performSearch(context.Background(), &SearchRequest{Text: "rust", Offset: reorderWindow, Limit: 10}); !errors.As(err, &queryErrs) {
+		t.Errorf("reranked search past the pool: error %v, want a query error", err)
+	}
+}
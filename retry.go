@@ -0,0 +1,309 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// retryBudgetMax is the number of retries a service can bank, which is also
+// the allowance it starts with
+const retryBudgetMax = 10
+
+// RetryPolicy is shared by the upstream HTTP clients. Failed idempotent
+// requests are retried with exponential backoff and jitter, or after the
+// upstream's Retry-After. Each request earns BudgetRatio of a retry, so a
+// struggling upstream sees at most that much extra traffic once the initial
+// allowance is spent.
+type RetryPolicy struct {
+	MaxAttempts int
+	BaseDelay   time.Duration
+	MaxDelay    time.Duration
+	BudgetRatio float64
+}
+
+// defaultRetryPolicy retries twice, the second time after about 400ms
+var defaultRetryPolicy = RetryPolicy{
+	MaxAttempts: 3,
+	BaseDelay:   200 * time.Millisecond,
+	MaxDelay:    5 * time.Second,
+	BudgetRatio: 0.2,
+}
+
+// retryPolicy is the policy of every retrying client. It holds the default
+// until main loads the configured one.
+var retryPolicy = defaultRetryPolicy
+
+// loadRetryPolicy reads RETRY_MAX_ATTEMPTS, RETRY_BASE_DELAY,
+// RETRY_MAX_DELAY and RETRY_BUDGET, falling back to the defaults
+func loadRetryPolicy() (RetryPolicy, error) {
+	policy := defaultRetryPolicy
+	if value := os.Getenv("RETRY_MAX_ATTEMPTS"); value != "" {
+		attempts, err := strconv.Atoi(value)
+		if err != nil || attempts < 1 {
+			return policy, fmt.Errorf("invalid RETRY_MAX_ATTEMPTS %q (expected 1 or more)", value)
+		}
+		policy.MaxAttempts = attempts
+	}
+	delays := []struct {
+		env string
+		d   *time.Duration
+	}{
+		{"RETRY_BASE_DELAY", &policy.BaseDelay},
+		{"RETRY_MAX_DELAY", &policy.MaxDelay},
+	}
+	for _, delay := range delays {
+		value := os.Getenv(delay.env)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return policy, fmt.Errorf("invalid %s %q (expected a duration such as 200ms)", delay.env, value)
+		}
+		*delay.d = d
+	}
+	if value := os.Getenv("RETRY_BUDGET"); value != "" {
+		ratio, err := strconv.ParseFloat(value, 64)
+		if err != nil || ratio < 0 {
+			return policy, fmt.Errorf("invalid RETRY_BUDGET %q (expected a ratio such as 0.2)", value)
+		}
+		policy.BudgetRatio = ratio
+	}
+	return policy, nil
+}
+
+// RetryStats counts the requests and retries made to one service
+type RetryStats struct {
+	Requests          int64 `json:"requests"`
+	Retries           int64 `json:"retries"`
+	RateLimited       int64 `json:"rate_limited"`
+	Exhausted         int64 `json:"exhausted"`
+	BudgetExhausted   int64 `json:"budget_exhausted"`
+	RetryAfterTooLong int64 `json:"retry_after_too_long"`
+}
+
+// retryTransport retries the requests of one service. Clients of the same
+// service share a transport, and with it a retry budget and statistics.
+type retryTransport struct {
+	service string
+	base    http.RoundTripper
+	stats   RetryStats
+
+	budgetMu sync.Mutex
+	budget   float64
+}
+
+var (
+	retryTransports   = make(map[string]*retryTransport)
+	retryTransportsMu sync.Mutex
+)
+
+// newRetryingClient returns an HTTP client whose requests to service are
+// retried under retryPolicy
+func newRetryingClient(service string) *http.Client {
+	retryTransportsMu.Lock()
+	defer retryTransportsMu.Unlock()
+	transport := retryTransports[service]
+	if transport == nil {
+		transport = &retryTransport{service: service, base: http.DefaultTransport, budget: retryBudgetMax}
+		retryTransports[service] = transport
+	}
+	return &http.Client{Transport: transport}
+}
+
+// retryStatsByService returns a snapshot of the retry counters of each
+// service
+func retryStatsByService() map[string]RetryStats {
+	retryTransportsMu.Lock()
+	defer retryTransportsMu.Unlock()
+	stats := make(map[string]RetryStats, len(retryTransports))
+	for service, transport := range retryTransports {
+		stats[service] = RetryStats{
+			Requests:          atomic.LoadInt64(&transport.stats.Requests),
+			Retries:           atomic.LoadInt64(&transport.stats.Retries),
+			RateLimited:       atomic.LoadInt64(&transport.stats.RateLimited),
+			Exhausted:         atomic.LoadInt64(&transport.stats.Exhausted),
+			BudgetExhausted:   atomic.LoadInt64(&transport.stats.BudgetExhausted),
+			RetryAfterTooLong: atomic.LoadInt64(&transport.stats.RetryAfterTooLong),
+		}
+	}
+	return stats
+}
+
+// markIdempotent lets a POST that only reads be retried. As with net/http,
+// an Idempotency-Key entry with no value marks the request without being
+// sent.
+func markIdempotent(req *http.Request) {
+	req.Header["Idempotency-Key"] = nil
+}
+
+// isIdempotent reports whether repeating req is safe
+func isIdempotent(req *http.Request) bool {
+	switch req.Method {
+	case "", http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodTrace:
+		return true
+	}
+	_, marked := req.Header["Idempotency-Key"]
+	return marked
+}
+
+func (rt *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	policy := retryPolicy
+	atomic.AddInt64(&rt.stats.Requests, 1)
+	rt.deposit(policy.BudgetRatio)
+
+	for attempt := 1; ; attempt++ {
+		resp, err := rt.base.RoundTrip(req)
+		reason := retryReason(req, resp, err)
+		if reason == "" || !isIdempotent(req) {
+			return resp, err
+		}
+		if resp != nil && resp.StatusCode == http.StatusTooManyRequests {
+			atomic.AddInt64(&rt.stats.RateLimited, 1)
+		}
+
+		delay, fromUpstream := retryAfter(resp)
+		if !fromUpstream {
+			delay = backoff(policy, attempt)
+		}
+		switch {
+		case attempt >= policy.MaxAttempts:
+			atomic.AddInt64(&rt.stats.Exhausted, 1)
+			return resp, err
+		case fromUpstream && delay > policy.MaxDelay:
+			atomic.AddInt64(&rt.stats.RetryAfterTooLong, 1)
+			return resp, err
+		case !beforeDeadline(req.Context(), delay):
+			return resp, err
+		case !rt.withdraw():
+			atomic.AddInt64(&rt.stats.BudgetExhausted, 1)
+			log.Printf("Retry budget for %s exhausted, not retrying %s: %s", rt.service, req.URL.Path, reason)
+			return resp, err
+		}
+
+		next, rewindErr := rewindRequest(req)
+		if rewindErr != nil {
+			return resp, err
+		}
+		if resp != nil {
+			io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+		atomic.AddInt64(&rt.stats.Retries, 1)
+		log.Printf("Retrying %s %s in %v (attempt %d of %d): %s", rt.service, req.URL.Path, delay.Round(time.Millisecond), attempt+1, policy.MaxAttempts, reason)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-timer.C:
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		}
+		req = next
+	}
+}
+
+// retryReason describes why an attempt is worth retrying, or returns "" if
+// it isn't: rate limits, transient 5xx responses and network errors are,
+// but not a cancelled or expired request
+func retryReason(req *http.Request, resp *http.Response, err error) string {
+	if err != nil {
+		if req.Context().Err() != nil {
+			return ""
+		}
+		return err.Error()
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests, http.StatusInternalServerError, http.StatusBadGateway,
+		http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return resp.Status
+	}
+	return ""
+}
+
+// retryAfter reads the Retry-After of a response, in seconds or as a date
+func retryAfter(resp *http.Response) (time.Duration, bool) {
+	if resp == nil {
+		return 0, false
+	}
+	value := resp.Header.Get("Retry-After")
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		if delay := time.Until(date); delay > 0 {
+			return delay, true
+		}
+		return 0, true
+	}
+	return 0, false
+}
+
+// backoff returns the delay before the retry after attempt: the base delay
+// doubled for each earlier retry, capped at the maximum, with the upper half
+// jittered so clients that failed together don't retry together
+func backoff(policy RetryPolicy, attempt int) time.Duration {
+	delay := policy.BaseDelay << (attempt - 1)
+	if delay > policy.MaxDelay || delay <= 0 {
+		delay = policy.MaxDelay
+	}
+	half := delay / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// beforeDeadline reports whether a retry after delay would start before
+// ctx expires
+func beforeDeadline(ctx context.Context, delay time.Duration) bool {
+	deadline, ok := ctx.Deadline()
+	return !ok || time.Now().Add(delay).Before(deadline)
+}
+
+// rewindRequest returns a copy of req with a fresh body to send again
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	next := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return next, nil
+	}
+	if req.GetBody == nil {
+		return nil, fmt.Errorf("request body can't be replayed")
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, err
+	}
+	next.Body = body
+	return next, nil
+}
+
+// deposit earns the service a fraction of a retry
+func (rt *retryTransport) deposit(ratio float64) {
+	rt.budgetMu.Lock()
+	defer rt.budgetMu.Unlock()
+	rt.budget += ratio
+	if rt.budget > retryBudgetMax {
+		rt.budget = retryBudgetMax
+	}
+}
+
+// withdraw spends one retry, reporting false when the budget is empty
+func (rt *retryTransport) withdraw() bool {
+	rt.budgetMu.Lock()
+	defer rt.budgetMu.Unlock()
+	if rt.budget < 1 {
+		return false
+	}
+	rt.budget--
+	return true
+}
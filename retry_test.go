@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// useRetryPolicy sets retryPolicy for one test
+func useRetryPolicy(t *testing.T, policy RetryPolicy) {
+	saved := retryPolicy
+	retryPolicy = policy
+	t.Cleanup(func() { retryPolicy = saved })
+}
+
+var fastRetryPolicy = RetryPolicy{MaxAttempts: 3, BaseDelay: time.Millisecond, MaxDelay: 50 * time.Millisecond, BudgetRatio: 0.2}
+
+// flakyServer fails its first failures requests with status, then answers
+// 200 with the request body
+func flakyServer(t *testing.T, failures int32, status int, header http.Header) (*httptest.Server, *int32) {
+	var calls int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) <= failures {
+			for key, values := range header {
+				w.Header()[key] = values
+			}
+			w.WriteHeader(status)
+			return
+		}
+		io.Copy(w, r.Body)
+	}))
+	t.Cleanup(server.Close)
+	return server, &calls
+}
+
+func newTestRetryTransport() *retryTransport {
+	return &retryTransport{service: "test", base: http.DefaultTransport, budget: retryBudgetMax}
+}
+
+func TestRetryTransientFailures(t *testing.T) {
+	useRetryPolicy(t, fastRetryPolicy)
+	server, calls := flakyServer(t, 2, http.StatusServiceUnavailable, nil)
+	transport := newTestRetryTransport()
+	client := &http.Client{Transport: transport}
+
+	req, _ := http.NewRequest("POST", server.URL, strings.NewReader("payload"))
+	markIdempotent(req)
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusOK || string(body) != "payload" {
+		t.Errorf("status %d, body %q: the body should be replayed on retry", resp.StatusCode, body)
+	}
+	if *calls != 3 || transport.stats.Retries != 2 {
+		t.Errorf("%d calls, %d retries", *calls, transport.stats.Retries)
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	useRetryPolicy(t, fastRetryPolicy)
+	tests := []struct {
+		name       string
+		status     int
+		header     http.Header
+		idempotent bool
+		calls      int32
+	}{
+		{"exhausted", http.StatusBadGateway, nil, true, 3},
+		{"client error", http.StatusBadRequest, nil, true, 1},
+		{"not idempotent", http.StatusServiceUnavailable, nil, false, 1},
+		{"retry-after too long", http.StatusTooManyRequests, http.Header{"Retry-After": {"60"}}, true, 1},
+	}
+	for _, tt := range tests {
+		server, calls := flakyServer(t, 10, tt.status, tt.header)
+		client := &http.Client{Transport: newTestRetryTransport()}
+		req, _ := http.NewRequest("POST", server.URL, strings.NewReader("payload"))
+		if tt.idempotent {
+			markIdempotent(req)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tt.status || *calls != tt.calls {
+			t.Errorf("%s: status %d after %d calls, want %d after %d", tt.name, resp.StatusCode, *calls, tt.status, tt.calls)
+		}
+	}
+}
+
+func TestRetryBudget(t *testing.T) {
+	useRetryPolicy(t, RetryPolicy{MaxAttempts: 5, BaseDelay: time.Millisecond, MaxDelay: time.Millisecond})
+	server, calls := flakyServer(t, 100, http.StatusServiceUnavailable, nil)
+	transport := newTestRetryTransport()
+	transport.budget = 2
+	client := &http.Client{Transport: transport}
+
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if *calls != 3 || transport.stats.BudgetExhausted != 1 {
+		t.Errorf("%d calls, budget exhausted %d times: want 2 retries from the budget", *calls, transport.stats.BudgetExhausted)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	header := func(value string) *http.Response {
+		return &http.Response{Header: http.Header{"Retry-After": {value}}}
+	}
+	if d, ok := retryAfter(header("3")); !ok || d != 3*time.Second {
+		t.Errorf("seconds: %v, %v", d, ok)
+	}
+	if d, ok := retryAfter(header(time.Now().Add(time.Hour).UTC().Format(http.TimeFormat))); !ok || d < 59*time.Minute {
+		t.Errorf("date: %v, %v", d, ok)
+	}
+	if _, ok := retryAfter(header("soon")); ok {
+		t.Error("an unparseable Retry-After should be ignored")
+	}
+	if _, ok := retryAfter(nil); ok {
+		t.Error("no response has no Retry-After")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{BaseDelay: 100 * time.Millisecond, MaxDelay: time.Second}
+	for attempt, max := range map[int]time.Duration{1: 100 * time.Millisecond, 2: 200 * time.Millisecond, 3: 400 * time.Millisecond, 10: time.Second} {
+		for i := 0; i < 20; i++ {
+			if d := backoff(policy, attempt); d < max/2 || d > max {
+				t.Errorf("attempt %d: backoff %v outside [%v, %v]", attempt, d, max/2, max)
+			}
+		}
+	}
+}
+
+func TestLoadRetryPolicy(t *testing.T) {
+	t.Setenv("RETRY_MAX_ATTEMPTS", "5")
+	t.Setenv("RETRY_BASE_DELAY", "50ms")
+	t.Setenv("RETRY_BUDGET", "0.5")
+	policy, err := loadRetryPolicy()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if policy.MaxAttempts != 5 || policy.BaseDelay != 50*time.Millisecond || policy.MaxDelay != defaultRetryPolicy.MaxDelay || policy.BudgetRatio != 0.5 {
+		t.Errorf("policy %+v", policy)
+	}
+
+	t.Setenv("RETRY_MAX_DELAY", "5")
+	if _, err := loadRetryPolicy(); err == nil {
+		t.Error("a delay without a unit should be rejected")
+	}
+}
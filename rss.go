@@ -2,10 +2,19 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
 	"time"
 )
 
+// RSS cache lifetimes. Entries are served for rssCacheTTL, then kept until
+// rssStaleTTL so that the last good feed can stand in while Voyage or
+// Pinecone is failing. An empty feed would make readers drop every item.
+const (
+	rssCacheTTL = 10 * time.Minute
+	rssStaleTTL = 24 * time.Hour
+)
+
 // handleRSSFeed processes RSS feed requests
 func (app *App) handleRSSFeed(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("qry")
@@ -18,34 +27,32 @@ func (app *App) handleRSSFeed(w http.ResponseWriter, r *http.Request) {
 	cacheKey := r.URL.RawQuery
 
 	// Check cache first
-	app.rssMutex.RLock()
-	if cached, exists := app.rssCache[cacheKey]; exists {
-		// Cache for 10 minutes
-		if time.Since(cached.timestamp) < 10*time.Minute {
-			app.rssMutex.RUnlock()
-			w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
-			w.Write([]byte(cached.content))
-			return
-		}
+	if content, ok := app.cachedRSS(cacheKey, rssCacheTTL); ok {
+		w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+		w.Write([]byte(content))
+		return
 	}
-	app.rssMutex.RUnlock()
 
-	// Perform search
-	results, _ := app.performSearch(query, r.URL.Query())
-
-	// Generate RSS feed
-	rssContent := app.generateRSSFeed(results, query, r)
-
-	// Cache the result
-	app.rssMutex.Lock()
-	app.rssCache[cacheKey] = RSSCacheItem{
-		content:   rssContent,
-		timestamp: time.Now(),
+	// Perform search, limiting how many posts each site contributes
+	req := searchRequestFromParams(r.URL.Query())
+	req.defaultPerDomain = rssPerDomain
+	if req.Namespace == namespaceAll {
+		// Feed entries aren't RSS items, so only the posts are needed
+		req.Namespace = "posts"
+	}
+	response, err := app.performSearch(r.Context(), req)
+	if isUpstreamFailure(err) {
+		app.serveStaleRSS(w, cacheKey, err)
+		return
+	}
+	if err != nil {
+		writeSearchError(w, err)
+		return
 	}
-	app.rssMutex.Unlock()
 
-	// Clean old cache entries occasionally
-	go app.cleanRSSCache()
+	// Generate RSS feed
+	rssContent := app.generateRSSFeed(response.Results, query, r)
+	app.storeRSS(cacheKey, rssContent)
 
 	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
 	w.Write([]byte(rssContent))
@@ -138,13 +145,52 @@ func (app *App) generateRSSFeed(results []SearchResult, query string, r *http.Re
 	return rss
 }
 
-// cleanRSSCache removes old entries from the RSS cache
+// cachedRSS returns the cached feed for key if it is younger than maxAge
+func (app *App) cachedRSS(key string, maxAge time.Duration) (string, bool) {
+	app.rssMutex.RLock()
+	defer app.rssMutex.RUnlock()
+	cached, exists := app.rssCache[key]
+	if !exists || time.Since(cached.timestamp) >= maxAge {
+		return "", false
+	}
+	return cached.content, true
+}
+
+// storeRSS caches a freshly generated feed
+func (app *App) storeRSS(key, content string) {
+	app.rssMutex.Lock()
+	app.rssCache[key] = RSSCacheItem{
+		content:   content,
+		timestamp: time.Now(),
+	}
+	app.rssMutex.Unlock()
+
+	// Clean old cache entries occasionally
+	go app.cleanRSSCache()
+}
+
+// serveStaleRSS answers a feed request that failed upstream with the last
+// good copy of the feed, or a 503 with Retry-After if there is none
+func (app *App) serveStaleRSS(w http.ResponseWriter, key string, err error) {
+	content, ok := app.cachedRSS(key, rssStaleTTL)
+	if !ok {
+		log.Printf("RSS unavailable, no cached copy: %v", err)
+		writeUnavailable(w, err)
+		return
+	}
+	log.Printf("RSS degraded, serving cached copy: %v", err)
+	w.Header().Set("Content-Type", "application/rss+xml; charset=utf-8")
+	w.Header().Set("Warning", `110 - "Response is Stale"`)
+	w.Write([]byte(content))
+}
+
+// cleanRSSCache removes entries from the RSS cache that are too old to
+// serve even while upstreams are failing
 func (app *App) cleanRSSCache() {
 	app.rssMutex.Lock()
 	defer app.rssMutex.Unlock()
 
-	// Remove cache entries older than 1 hour
-	cutoff := time.Now().Add(-1 * time.Hour)
+	cutoff := time.Now().Add(-rssStaleTTL)
 	for key, item := range app.rssCache {
 		if item.timestamp.Before(cutoff) {
 			delete(app.rssCache, key)
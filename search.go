@@ -1,323 +1,258 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log"
-	"regexp"
 	"sort"
-	"strconv"
 	"strings"
 	"time"
 )
 
-// SearchQuery contains parsed search parameters
-type SearchQuery struct {
-	Text     string
-	Filters  map[string]interface{}
-	SortBy   string
-	Negation string
-	IsLike   bool
-	LikeURL  string
-}
-
-// parseSearchQuery parses the search query string and extracts filters
-func parseSearchQuery(query string) (SearchQuery, error) {
-	sq := SearchQuery{
-		Text:    query,
-		Filters: make(map[string]interface{}),
-	}
-
-	// Parse type: filter
-	if match := regexp.MustCompile(`type:(\w+)`).FindStringSubmatch(query); len(match) > 1 {
-		typeVal := match[1]
-		sq.Text = strings.ReplaceAll(sq.Text, match[0], "")
-		// Only add rsstype filter for non-feed searches
-		if typeVal != "" && typeVal != "everything" && typeVal != "feeds" {
-			sq.Filters["rsstype"] = map[string]interface{}{"$eq": getTypeMapping(typeVal)}
-		}
+// performSearch executes a search request and returns the requested page of
+// results. Query errors are returned as QueryErrors and outages of Voyage or
+// Pinecone as an UpstreamError, so that they aren't mistaken for a search
+// that found nothing. A like: target that isn't indexed finds nothing; other
+// problems are returned as they are. The whole search, including every
+// upstream call it makes, is cancelled with ctx or when the search timeout
+// passes.
+func (app *App) performSearch(ctx context.Context, req *SearchRequest) (SearchResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, app.timeouts.Search)
+	defer cancel()
+	if req.Namespace == namespaceAll {
+		return app.performUnifiedSearch(ctx, req)
 	}
+	start := time.Now()
 
-	// Parse sype: filter (site type)
-	if match := regexp.MustCompile(`sype:(\w+)`).FindStringSubmatch(query); len(match) > 1 {
-		stype := match[1]
-		sq.Text = strings.ReplaceAll(sq.Text, match[0], "")
-		if stype != "" && stype != "everything" {
-			sq.Filters["site_type"] = map[string]interface{}{"$in": getSiteTypeMapping(stype)}
-		}
+	// Compile the query text and typed filters
+	req.rerank = app.reranks()
+	parsedQuery, err := req.parse()
+	if err != nil {
+		return SearchResponse{}, err
 	}
+	isFeedSearch := parsedQuery.IsFeedSearch
 
-	// Parse oype: filter (owner type)
-	if match := regexp.MustCompile(`oype:(\w+)`).FindStringSubmatch(query); len(match) > 1 {
-		otype := match[1]
-		sq.Text = strings.ReplaceAll(sq.Text, match[0], "")
-		if otype != "" && otype != "everything" {
-			if otype == "individual" {
-				sq.Filters["owner_type"] = map[string]interface{}{"$eq": otype}
-			} else {
-				sq.Filters["owner_type"] = map[string]interface{}{"$ne": "individual"}
-			}
-		}
+	// Perform search using API clients, fetching enough to skip to the
+	// offset, or the larger pool the reranker asks for
+	window := req.searchWindow(&parsedQuery)
+	candidates := window
+	if parsedQuery.Text != "" {
+		candidates = app.reranker.Candidates(window)
 	}
-
-	// Parse since: filter
-	if match := regexp.MustCompile(`since:(\w+)`).FindStringSubmatch(query); len(match) > 1 {
-		since := match[1]
-		sq.Text = strings.ReplaceAll(sq.Text, match[0], "")
-		if sinceSeconds, ok := getSinceMapping(since); ok {
-			sq.Filters["unix_time"] = map[string]interface{}{"$gt": time.Now().Unix() - sinceSeconds}
+	results, err := app.searchContent(ctx, parsedQuery, candidates)
+	if err != nil {
+		log.Printf("Search error: %v", err)
+		if errors.Is(err, errVectorNotFound) {
+			return SearchResponse{Results: []SearchResult{}, Limit: req.limit()}, nil
 		}
+		return SearchResponse{}, err
 	}
 
-	// Parse site: filter
-	if match := regexp.MustCompile(`site:(.*?)( |$)`).FindStringSubmatch(query); len(match) > 1 {
-		site := strings.TrimSpace(match[1])
-		sq.Text = strings.ReplaceAll(sq.Text, match[0], "")
-		// Use different field name based on whether this is a feeds search
-		if strings.Contains(sq.Text, "type:feeds") || strings.Contains(query, "type:feeds") {
-			sq.Filters["baseurl"] = map[string]interface{}{"$eq": site}
-		} else {
-			sq.Filters["base_url"] = map[string]interface{}{"$eq": site}
-		}
-	}
+	// Rerank the candidates against the query text and keep the window
+	results, reranked := app.rerankResults(ctx, parsedQuery.Text, results, window)
 
-	// Parse lang: filter
-	if match := regexp.MustCompile(`lang:([^\s]+)`).FindStringSubmatch(query); len(match) > 1 {
-		lang := match[1]
-		sq.Text = strings.ReplaceAll(sq.Text, match[0], "")
-		sq.Filters["lang"] = map[string]interface{}{"$eq": lang}
+	// Deduplicate posts by title (for posts search only)
+	if !isFeedSearch && len(results) > 0 {
+		results = deduplicateByTitle(results)
 	}
 
-	// Parse score: filter
-	if match := regexp.MustCompile(`score:([\d.]+)`).FindStringSubmatch(query); len(match) > 1 {
-		if score, err := strconv.ParseFloat(match[1], 64); err == nil {
-			sq.Text = strings.ReplaceAll(sq.Text, match[0], "")
-			sq.Filters["score"] = map[string]interface{}{"$gt": score}
-		}
-	}
+	// Blend relevance with freshness, quality and length when a rank
+	// profile asks for it
+	rankResults(results, parsedQuery.Rank, time.Now())
 
-	// Parse length: filter
-	if match := regexp.MustCompile(`length:(\d+)`).FindStringSubmatch(query); len(match) > 1 {
-		if length, err := strconv.Atoi(match[1]); err == nil {
-			sq.Text = strings.ReplaceAll(sq.Text, match[0], "")
-			sq.Filters["length"] = map[string]interface{}{"$gt": length}
+	// Diversify posts so that a single site can't fill the page. Posts from
+	// a site: search all share a domain, so they aren't capped.
+	if !isFeedSearch && len(results) > 0 {
+		results = diversifyResults(results, parsedQuery.Diversity)
+		if parsedQuery.PerDomain != nil && !parsedQuery.HasSiteFilter {
+			results = capPerDomain(results, *parsedQuery.PerDomain)
 		}
 	}
 
-	// Parse like: filter
-	if match := regexp.MustCompile(`like:([^\s]+)`).FindStringSubmatch(query); len(match) > 1 {
-		sq.IsLike = true
-		sq.LikeURL = match[1]
-		sq.Text = strings.ReplaceAll(sq.Text, match[0], "")
-	}
-
-	// Parse negation <text>
-	if match := regexp.MustCompile(`<([^>]+)>`).FindStringSubmatch(query); len(match) > 1 {
-		sq.Negation = match[1]
-		sq.Text = strings.ReplaceAll(sq.Text, match[0], "")
-	}
-
-	// Parse sort: filter
-	if match := regexp.MustCompile(`sort:([^\s]+)`).FindStringSubmatch(query); len(match) > 1 {
-		sq.SortBy = match[1]
-		sq.Text = strings.ReplaceAll(sq.Text, match[0], "")
-	}
-
-	// Clean up the text
-	sq.Text = strings.TrimSpace(sq.Text)
-	if sq.Text == "" {
-		sq.Text = "a" // Default fallback
-	}
-
-	return sq, nil
-}
-
-// getTypeMapping maps content types to internal values
-func getTypeMapping(t string) string {
-	mapping := map[string]string{
-		"news":     "news",
-		"academic": "academic",
-		"arxiv":    "academic",
-		"papers":   "academic",
-		"journals": "academic",
-		"blog":     "blog",
-		"blogs":    "blog",
-	}
-	if val, ok := mapping[t]; ok {
-		return val
-	}
-	return t
-}
-
-// getSiteTypeMapping maps site types to internal values
-func getSiteTypeMapping(stype string) []string {
-	mapping := map[string][]string{
-		"blog":     {"blog", "individual / personal blog"},
-		"periodic": {"periodic newsletter digest"},
-		"eng":      {"company engineering blog"},
-		"news":     {"news / media publication"},
-	}
-	if val, ok := mapping[stype]; ok {
-		return val
+	// Apply the requested sort. Posts from a site: search are listed newest
+	// first unless the query asks for something else.
+	sortKeys := parsedQuery.Sort
+	if len(sortKeys) == 0 && parsedQuery.HasSiteFilter && !isFeedSearch {
+		sortKeys = []SortKey{{Field: "date"}}
 	}
-	return []string{stype}
-}
-
-// getSinceMapping maps time periods to seconds
-func getSinceMapping(since string) (int64, bool) {
-	mapping := map[string]int64{
-		"yesterday":     24 * 60 * 60,
-		"last_3days":    3 * 24 * 60 * 60,
-		"last_week":     7 * 24 * 60 * 60,
-		"last_month":    30 * 24 * 60 * 60,
-		"last_3months":  3 * 30 * 24 * 60 * 60,
-		"last_year":     365 * 24 * 60 * 60,
+	if len(sortKeys) > 0 {
+		sortResults(results, sortKeys)
 	}
-	val, ok := mapping[since]
-	return val, ok
-}
-
-// performSearch executes a search query with filters and returns results
-func (app *App) performSearch(query string, params map[string][]string) ([]SearchResult, float64) {
-	start := time.Now()
 
-	// Build search query with filters
-	searchQuery := query
-	searchType := getStringDefault(getParam(params, "type"), "pages")
-	content := getParam(params, "content")
-	timeFilter := getParam(params, "time")
-	includePosts := getParam(params, "include_posts") == "true"
-	sortBy := getParam(params, "sort")
+	var response SearchResponse
+	req.paginate(results, &response)
 
-	if searchType == "sites" {
-		searchQuery += " type:feeds"
-	} else {
-		if content != "" {
-			searchQuery += " type:" + content
-		}
-		// Add time filter only if explicitly specified
-		if timeFilter != "" {
-			searchQuery += " since:last_" + timeFilter
-		}
+	// Mark the query terms in the title and snippet of each result
+	h := newHighlighter(parsedQuery.Text)
+	for i := range response.Results {
+		response.Results[i].Highlights = h.highlight(&response.Results[i])
 	}
 
-	// Perform search using API clients
-	results, err := app.searchContent(searchQuery, 50)
-	if err != nil {
-		log.Printf("Search error: %v", err)
-		return []SearchResult{}, 0.0
+	// If this is a feed search and include_posts is true, fetch the latest
+	// posts of the feeds on this page
+	if isFeedSearch && req.IncludePosts && len(response.Results) > 0 {
+		app.enrichWithLatestPosts(ctx, response.Results, req.latestPosts())
 	}
 
-	// If this is a feed search and include_posts is true, fetch latest posts
-	if searchType == "sites" && includePosts && len(results) > 0 {
-		latestPosts := app.getLatestPostsForFeeds(results)
-		
-		// Populate latest post fields for each feed result
-		for i := range results {
-			if latestPost, exists := latestPosts[results[i].OriginalDomain]; exists {
-				results[i].LatestPostTitle = latestPost.Title
-				results[i].LatestPostURL = latestPost.URL
-				results[i].LatestPostDate = latestPost.Date
-				results[i].LatestPostSnippet = latestPost.Subtitle
-			}
+	// Group the page into topics, listing the results cluster by cluster
+	if req.Clusters > 0 && len(response.Results) > 0 {
+		response.Clusters = clusterResults(response.Results, req.Clusters)
+		grouped := make([]SearchResult, 0, len(response.Results))
+		for _, cluster := range response.Clusters {
+			grouped = append(grouped, cluster.Results...)
 		}
+		response.Results = grouped
 	}
-
-	// Deduplicate posts by title (for pages search only)
-	if searchType == "pages" && len(results) > 0 {
-		results = deduplicateByTitle(results)
-	}
-
-	// Apply sorting for posts (not feeds)
-	if searchType == "pages" && sortBy == "time" && len(results) > 0 {
-		sortResultsByTime(results)
+	response.Rank = parsedQuery.Rank
+	response.Reranked = reranked
+	if req.Facets {
+		response.Facets = computeFacets(results)
 	}
-
-	timeTaken := time.Since(start).Seconds()
-	return results, timeTaken
+	response.TimeTaken = time.Since(start).Seconds()
+	return response, nil
 }
 
-// searchContent performs the actual search using Pinecone and Voyage APIs
-func (app *App) searchContent(query string, maxResults int) ([]SearchResult, error) {
-	log.Printf("DEBUG searchContent: Received query: '%s'", query)
-	
-	// Parse query for filters and special syntax
-	parsedQuery, err := parseSearchQuery(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse query: %w", err)
-	}
-	log.Printf("DEBUG searchContent: Parsed query - Text: '%s', Filters: %+v", parsedQuery.Text, parsedQuery.Filters)
+// queryEmbedding returns the vector a query searches with: the stored vector
+// of a like: target, the embedded query text, or the generic filter
+// embedding for queries that only filter
+func (app *App) queryEmbedding(ctx context.Context, parsedQuery SearchQuery) ([]float64, error) {
+	isFeedSearch := parsedQuery.IsFeedSearch
+	corpus := corpusFor(isFeedSearch)
 	var embedding []float64
+	var err error
 
 	// Check for "like:" syntax
 	if parsedQuery.IsLike {
 		// Determine if this is a domain (for similar blogs) or a full URL (for similar posts)
 		isDomain := !strings.HasPrefix(parsedQuery.LikeURL, "http://") && !strings.HasPrefix(parsedQuery.LikeURL, "https://")
 		
-		if isDomain || strings.Contains(query, "type:feeds") {
+		if isDomain || isFeedSearch {
 			// For feeds search or domain-based search, find similar blogs
-			embedding, err = app.getSimilarBlogEmbedding(parsedQuery.LikeURL)
+			embedding, err = app.getSimilarBlogEmbedding(ctx, parsedQuery.LikeURL)
 			if err != nil {
 				return nil, fmt.Errorf("failed to get embedding for similar blogs: %w", err)
 			}
 		} else {
 			// For posts search, get embedding from Pinecone for this URL
-			embedding, err = app.pineconeAPI.GetEmbedding(parsedQuery.LikeURL)
+			fetchCtx, cancel := context.WithTimeout(ctx, app.timeouts.Retrieve)
+			embedding, err = corpus.client.GetEmbeddingFromNamespace(fetchCtx, parsedQuery.LikeURL, corpus.Namespace)
+			err = upstreamFailure("pinecone", err)
+			cancel()
 			if err != nil {
 				return nil, fmt.Errorf("failed to get embedding for URL: %w", err)
 			}
 		}
-	} else if parsedQuery.Text != "" && parsedQuery.Text != "a" {
+	} else if parsedQuery.Text != "" {
 		// Get embedding from Voyage API
-		embedding, err = app.voyageAPI.GetEmbedding(parsedQuery.Text)
+		embedding, err = app.embed(ctx, parsedQuery.Text)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get embedding: %w", err)
 		}
 	} else if len(parsedQuery.Filters) > 0 {
 		// For site: queries with no text, use a generic search term
-		embedding, err = app.voyageAPI.GetEmbedding("content")
+		embedding, err = app.filterEmbedding(ctx)
 		if err != nil {
 			return nil, fmt.Errorf("failed to get embedding for filtered search: %w", err)
 		}
 	}
+	return embedding, nil
+}
 
-	// Query Pinecone - determine namespace
-	namespace := "blaze-content-v3" // Default to content namespace
-	log.Printf("DEBUG: Checking for 'type:feeds' in query: '%s'", query)
-	if strings.Contains(query, "type:feeds") {
-		namespace = "blaze-feeds-v3"
-		log.Printf("DEBUG: Using feeds namespace: %s", namespace)
-	} else {
-		log.Printf("DEBUG: Using content namespace: %s", namespace)
+// embed embeds query text within the embedding deadline
+func (app *App) embed(ctx context.Context, text string) ([]float64, error) {
+	ctx, cancel := context.WithTimeout(ctx, app.timeouts.Embed)
+	defer cancel()
+	embedding, err := app.embedder.GetEmbeddingWithType(ctx, text, "query")
+	return embedding, upstreamFailure("embedder", err)
+}
+
+// searchContent performs the actual search using Pinecone and Voyage APIs
+func (app *App) searchContent(ctx context.Context, parsedQuery SearchQuery, maxResults int) ([]SearchResult, error) {
+	log.Printf("DEBUG searchContent: Parsed query - Text: '%s', Filters: %+v", parsedQuery.Text, parsedQuery.Filters)
+	isFeedSearch := parsedQuery.IsFeedSearch
+	corpus := corpusFor(isFeedSearch)
+	embedding, err := app.queryEmbedding(ctx, parsedQuery)
+	if err != nil {
+		return nil, err
 	}
+
+	// Query Pinecone - the corpus determines the namespace
+	namespace := corpus.Namespace
+	log.Printf("DEBUG: Using %s corpus namespace: %s", corpus.Name, namespace)
 	log.Printf("DEBUG: Final namespace: %s, Filters: %+v", namespace, parsedQuery.Filters)
 
 	// Debug logging for site: queries
-	if strings.Contains(query, "site:") {
-		log.Printf("DEBUG: Original query: %s", query)
+	if parsedQuery.HasSiteFilter {
 		log.Printf("DEBUG: Parsed text: %s", parsedQuery.Text)
 		log.Printf("DEBUG: Filters: %+v", parsedQuery.Filters)
 		log.Printf("DEBUG: Namespace: %s", namespace)
 	}
 
-	pineconeResults, err := app.pineconeAPI.Query(namespace, embedding, parsedQuery.Filters, maxResults)
+	var pineconeResults []PineconeMatch
+	if parsedQuery.Negation != "" && len(embedding) > 0 {
+		// Embed the <negated> concept and steer the query away from it
+		var negationEmbedding []float64
+		negationEmbedding, err = app.embed(ctx, parsedQuery.Negation)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get embedding for negation: %w", err)
+		}
+		adjusted := adjustForNegation(embedding, negationEmbedding, parsedQuery.NegationWeight)
+
+		// Fetch spare candidates with their vectors so that hits too close to
+		// the negated concept can be dropped without leaving the page short
+		spare := maxResults * 2
+		if spare > pineconeMaxTopK {
+			spare = pineconeMaxTopK
+		}
+		queryCtx, cancel := context.WithTimeout(ctx, app.timeouts.Retrieve)
+		pineconeResults, err = corpus.client.QueryWithValues(queryCtx, namespace, adjusted, parsedQuery.Filters, spare)
+		cancel()
+		if err == nil {
+			pineconeResults = rerankAwayFromNegation(pineconeResults, embedding, negationEmbedding, parsedQuery.NegationWeight)
+			if len(pineconeResults) > maxResults {
+				pineconeResults = pineconeResults[:maxResults]
+			}
+		}
+	} else {
+		// Diversification and clustering compare the vectors of the results
+		query := corpus.client.Query
+		if parsedQuery.IncludeValues || (parsedQuery.Diversity > 0 && !isFeedSearch) {
+			query = corpus.client.QueryWithValues
+		}
+		queryCtx, cancel := context.WithTimeout(ctx, app.timeouts.Retrieve)
+		pineconeResults, err = query(queryCtx, namespace, embedding, parsedQuery.Filters, maxResults)
+		cancel()
+	}
 	if err != nil {
-		return nil, fmt.Errorf("pinecone query failed: %w", err)
+		return nil, upstreamFailure("pinecone", fmt.Errorf("pinecone query failed: %w", err))
+	}
+
+	// Index what Pinecone returned so that exact names can be found lexically,
+	// then rank by the requested mode
+	app.lexicalIndex.add(corpus, pineconeResults)
+	switch parsedQuery.Mode {
+	case searchModeLexical:
+		pineconeResults = app.lexicalIndex.search(corpus, parsedQuery, maxResults)
+	case searchModeHybrid:
+		lexicalResults := app.lexicalIndex.search(corpus, parsedQuery, maxResults)
+		pineconeResults = fuseRankings(pineconeResults, lexicalResults)
+		if len(pineconeResults) > maxResults {
+			pineconeResults = pineconeResults[:maxResults]
+		}
 	}
 
 	// Debug logging for results
 	log.Printf("DEBUG: Pinecone returned %d results", len(pineconeResults))
-	if strings.Contains(query, "site:") {
-		log.Printf("DEBUG SITE SEARCH: Query=%s, Namespace=%s, Filters=%+v, Results=%d", 
-			query, namespace, parsedQuery.Filters, len(pineconeResults))
+	if parsedQuery.HasSiteFilter {
+		log.Printf("DEBUG SITE SEARCH: Text=%s, Namespace=%s, Filters=%+v, Results=%d", 
+			parsedQuery.Text, namespace, parsedQuery.Filters, len(pineconeResults))
 		for i, result := range pineconeResults {
 			if i < 3 { // Log first 3 results
 				log.Printf("DEBUG SITE RESULT %d: ID=%s, Score=%.3f, Metadata keys=%v", 
 					i, result.ID, result.Score, getMetadataKeys(result.Metadata))
-				if baseURL := getMetadataString(result.Metadata, "baseurl"); baseURL != "" {
-					log.Printf("DEBUG SITE RESULT %d: baseurl=%s", i, baseURL)
-				}
-				if baseURL := getMetadataString(result.Metadata, "base_url"); baseURL != "" {
-					log.Printf("DEBUG SITE RESULT %d: base_url=%s", i, baseURL)
+				if baseURL := getMetadataString(result.Metadata, corpus.Fields.BaseURL); baseURL != "" {
+					log.Printf("DEBUG SITE RESULT %d: %s=%s", i, corpus.Fields.BaseURL, baseURL)
 				}
 			}
 		}
@@ -325,21 +260,14 @@ func (app *App) searchContent(query string, maxResults int) ([]SearchResult, err
 
 	// Convert to search results
 	results := make([]SearchResult, len(pineconeResults))
-	isFeedSearch := strings.Contains(query, "type:feeds")
 
 	for i, result := range pineconeResults {
-		title := getMetadataString(result.Metadata, "title")
-		subtitle := getMetadataString(result.Metadata, "subtitle")
+		title := corpus.title(result.Metadata)
+		subtitle := corpus.field(result.Metadata, corpus.Fields.Subtitle)
+		baseURL := getMetadataString(result.Metadata, corpus.Fields.BaseURL)
 		
-		// For feed searches, construct different title/subtitle and URL mapping
+		// For feed searches, construct a different URL mapping
 		if isFeedSearch {
-			ownerName := getMetadataString(result.Metadata, "owner_name")
-			if ownerName != "" {
-				title = ownerName
-			}
-			subtitle = getMetadataString(result.Metadata, "short_summary")
-			
-			baseURL := getMetadataString(result.Metadata, "baseurl")
 			results[i] = SearchResult{
 				URL:            baseURL,  // Use baseurl for feeds
 				Title:          title,
@@ -350,156 +278,152 @@ func (app *App) searchContent(query string, maxResults int) ([]SearchResult, err
 				IsFeed:         isFeedSearch,
 				RSSURL:         result.ID, // RSS feed URL is stored in Pinecone ID
 				OriginalDomain: baseURL, // Keep full URL format to match Pinecone schema
+				metadata:       result.Metadata,
+				vector:         result.Values,
 			}
 		} else {
-			baseURL := getMetadataString(result.Metadata, "base_url")
 			results[i] = SearchResult{
 				URL:            result.ID,
 				Title:          title,
 				Subtitle:       subtitle,
-				Date:           formatDate(getMetadataString(result.Metadata, "dt_published")),
+				Date:           formatDate(corpus.field(result.Metadata, corpus.Fields.Published)),
 				Score:          result.Score,
 				BaseDomain:     cleanURL(baseURL),
 				IsFeed:         isFeedSearch,
 				RSSURL:         "",
 				OriginalDomain: baseURL,
+				Length:         getMetadataInt(result.Metadata, corpus.Fields.Length),
+				published:      parseTimeFromMetadata(result.Metadata, corpus.Fields.Published),
+				quality:        getMetadataFloat(result.Metadata, corpus.Fields.Quality),
+				metadata:       result.Metadata,
+				vector:         result.Values,
 			}
 		}
 	}
 
-	// Sort by time in descending order if this is a site search for posts (not feeds)
-	if !isFeedSearch && strings.Contains(query, "site:") {
-		// Create a slice with both results and original metadata for sorting
-		type resultWithMetadata struct {
-			result   SearchResult
-			metadata map[string]interface{}
-		}
-		
-		resultsWithMeta := make([]resultWithMetadata, len(results))
-		for i, result := range results {
-			resultsWithMeta[i] = resultWithMetadata{
-				result:   result,
-				metadata: pineconeResults[i].Metadata,
-			}
-		}
-		
-		// Sort by time - more recent dates come first
-		sort.Slice(resultsWithMeta, func(i, j int) bool {
-			dateI := parseTimeFromMetadata(resultsWithMeta[i].metadata)
-			dateJ := parseTimeFromMetadata(resultsWithMeta[j].metadata)
-			return dateI.After(dateJ)
-		})
-		
-		// Extract sorted results back to the results array
-		for i, rwm := range resultsWithMeta {
-			results[i] = rwm.result
-		}
-	}
-
 	return results, nil
 }
 
-// getLatestPostsForFeeds fetches the latest post for each feed's base URL
-func (app *App) getLatestPostsForFeeds(feedResults []SearchResult) map[string]SearchResult {
-	latestPosts := make(map[string]SearchResult)
-	
-	// Use a generic embedding for filtering (we only care about base_url filtering)
-	genericEmbedding, err := app.voyageAPI.GetEmbedding("content")
+// latestPostWorkers bounds the concurrent Pinecone queries made while
+// enriching feeds with their latest posts
+const latestPostWorkers = 8
+
+// enrichWithLatestPosts fills in the latest posts of every feed using a
+// bounded pool of workers. Feeds whose posts can't be fetched report the
+// problem in EnrichmentError instead.
+func (app *App) enrichWithLatestPosts(ctx context.Context, feeds []SearchResult, perFeed int) {
+	// Only base_url filtering matters, so one generic embedding serves all
+	embedding, err := app.filterEmbedding(ctx)
 	if err != nil {
-		log.Printf("Error getting generic embedding for latest posts: %v", err)
-		return latestPosts
-	}
-	
-	// Query latest post for each feed (limit to first 20 feeds for performance)
-	maxFeeds := 20
-	if len(feedResults) < maxFeeds {
-		maxFeeds = len(feedResults)
-	}
-	
-	for i := 0; i < maxFeeds; i++ {
-		feed := feedResults[i]
-		baseURL := feed.OriginalDomain
-		
-		if baseURL == "" {
-			continue
-		}
-		
-		// Create filter for this specific base_url
-		filters := map[string]interface{}{
-			"base_url": map[string]interface{}{"$eq": baseURL},
+		for i := range feeds {
+			feeds[i].EnrichmentError = fmt.Sprintf("latest posts unavailable: %v", err)
 		}
-		
-		// Query content namespace for posts from this base URL
-		results, err := app.pineconeAPI.Query("blaze-content-v3", genericEmbedding, filters, 50)
+		return
+	}
+
+	forEachConcurrently(len(feeds), latestPostWorkers, func(i int) {
+		posts, err := app.getLatestPosts(ctx, feeds[i].OriginalDomain, embedding, perFeed)
 		if err != nil {
-			log.Printf("Error querying latest posts for %s: %v", baseURL, err)
-			continue
+			feeds[i].EnrichmentError = err.Error()
+			return
 		}
-		
-		if len(results) == 0 {
-			continue
+		feeds[i].LatestPosts = posts
+		if len(posts) > 0 {
+			feeds[i].LatestPostTitle = posts[0].Title
+			feeds[i].LatestPostURL = posts[0].URL
+			feeds[i].LatestPostDate = posts[0].Date
+			feeds[i].LatestPostSnippet = posts[0].Subtitle
 		}
-		
-		// Sort results by date to find the latest
-		sort.Slice(results, func(i, j int) bool {
-			dateI := parseTimeFromMetadata(results[i].Metadata)
-			dateJ := parseTimeFromMetadata(results[j].Metadata)
-			return dateI.After(dateJ) // Most recent first
-		})
-		
-		// Get the latest post
-		latestResult := results[0]
-		latestPost := SearchResult{
-			URL:      latestResult.ID,
-			Title:    getMetadataString(latestResult.Metadata, "title"),
-			Subtitle: getMetadataString(latestResult.Metadata, "subtitle"),
-			Date:     formatDate(getMetadataString(latestResult.Metadata, "dt_published")),
+	})
+}
+
+// getLatestPosts fetches the newest posts published under a feed's base URL
+func (app *App) getLatestPosts(ctx context.Context, baseURL string, embedding []float64, count int) ([]SearchResult, error) {
+	if baseURL == "" {
+		return nil, fmt.Errorf("feed has no base URL")
+	}
+
+	// Create filter for this specific base URL
+	posts := corpora[corpusPosts]
+	filters := map[string]interface{}{
+		posts.Fields.BaseURL: map[string]interface{}{"$eq": baseURL},
+	}
+
+	// Query the posts corpus for posts from this base URL
+	ctx, cancel := context.WithTimeout(ctx, app.timeouts.Enrich)
+	defer cancel()
+	results, err := posts.client.Query(ctx, posts.Namespace, embedding, filters, 50)
+	if err != nil {
+		return nil, fmt.Errorf("latest posts query failed: %w", err)
+	}
+
+	// Sort results by date to find the latest
+	sort.Slice(results, func(i, j int) bool {
+		dateI := parseTimeFromMetadata(results[i].Metadata, posts.Fields.Published)
+		dateJ := parseTimeFromMetadata(results[j].Metadata, posts.Fields.Published)
+		return dateI.After(dateJ) // Most recent first
+	})
+	if len(results) > count {
+		results = results[:count]
+	}
+
+	latest := make([]SearchResult, len(results))
+	for i, result := range results {
+		latest[i] = SearchResult{
+			URL:      result.ID,
+			Title:    posts.title(result.Metadata),
+			Subtitle: posts.field(result.Metadata, posts.Fields.Subtitle),
+			Date:     formatDate(posts.field(result.Metadata, posts.Fields.Published)),
 		}
-		
-		latestPosts[baseURL] = latestPost
 	}
-	
-	return latestPosts
+	return latest, nil
+}
+
+// filterEmbedding returns the generic embedding used for queries that only
+// filter on metadata. The embedding cache keeps it after the first call.
+func (app *App) filterEmbedding(ctx context.Context) ([]float64, error) {
+	return app.embed(ctx, "content")
 }
 
 // getSimilarBlogEmbedding gets an embedding for finding similar blogs
-func (app *App) getSimilarBlogEmbedding(domain string) ([]float64, error) {
-	// First, search for the specific domain in feeds using a generic embedding to filter by baseurl
-	genericEmbedding, err := app.voyageAPI.GetEmbedding("blog content")
+func (app *App) getSimilarBlogEmbedding(ctx context.Context, domain string) ([]float64, error) {
+	// First, search for the specific domain in feeds using a generic embedding to filter by base URL
+	genericEmbedding, err := app.embed(ctx, "blog content")
 	if err != nil {
 		return nil, fmt.Errorf("failed to get generic embedding: %w", err)
 	}
 	
+	feeds := corpora[corpusFeeds]
 	domainFilters := map[string]interface{}{
-		"baseurl": map[string]interface{}{"$eq": domain},
+		feeds.Fields.BaseURL: map[string]interface{}{"$eq": domain},
 	}
 	
 	// Search for the specific domain in feeds to get its ID
-	domainResults, err := app.pineconeAPI.Query("blaze-feeds-v2", genericEmbedding, domainFilters, 1)
+	queryCtx, cancel := context.WithTimeout(ctx, app.timeouts.Retrieve)
+	defer cancel()
+	domainResults, err := feeds.client.Query(queryCtx, feeds.Namespace, genericEmbedding, domainFilters, 1)
 	if err != nil {
-		return nil, fmt.Errorf("failed to find domain in feeds: %w", err)
+		return nil, upstreamFailure("pinecone", fmt.Errorf("failed to find domain in feeds: %w", err))
 	}
 	
 	if len(domainResults) == 0 {
 		// If we can't find the exact domain, use the domain text as fallback
-		return app.voyageAPI.GetEmbedding(domain)
+		return app.embed(ctx, domain)
 	}
 	
 	// Get the embedding from the found domain entry using the feeds namespace
-	return app.pineconeAPI.GetEmbeddingFromNamespace(domainResults[0].ID, "blaze-feeds-v2")
+	embedding, err := feeds.client.GetEmbeddingFromNamespace(queryCtx, domainResults[0].ID, feeds.Namespace)
+	return embedding, upstreamFailure("pinecone", err)
 }
 
 // convertFeedResults converts Pinecone matches to SearchResult format for feeds
 func (app *App) convertFeedResults(pineconeResults []PineconeMatch) []SearchResult {
+	feeds := corpora[corpusFeeds]
 	results := make([]SearchResult, len(pineconeResults))
 	for i, result := range pineconeResults {
-		title := getMetadataString(result.Metadata, "title")
-		ownerName := getMetadataString(result.Metadata, "owner_name")
-		if ownerName != "" {
-			title = ownerName
-		}
-		subtitle := getMetadataString(result.Metadata, "short_summary")
-		baseURL := getMetadataString(result.Metadata, "baseurl")
+		title := feeds.title(result.Metadata)
+		subtitle := feeds.field(result.Metadata, feeds.Fields.Subtitle)
+		baseURL := getMetadataString(result.Metadata, feeds.Fields.BaseURL)
 		
 		results[i] = SearchResult{
 			URL:            baseURL,  // Use baseurl for feeds
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// SortKey orders results by one field. Each field has a natural direction:
+// newest, highest scoring and longest first, and domains from A to Z.
+// Reverse flips it, written as a leading "-" in sort:-date.
+type SortKey struct {
+	Field   string `json:"field"`
+	Reverse bool   `json:"reverse,omitempty"`
+}
+
+// sortFieldAliases maps accepted sort names to their canonical field
+var sortFieldAliases = map[string]string{
+	"date":      "date",
+	"time":      "date",
+	"score":     "score",
+	"relevance": "score",
+	"domain":    "domain",
+	"site":      "domain",
+	"length":    "length",
+}
+
+// parseSortKeys parses a comma separated list of sort keys such as
+// "-date,score". Later keys break ties in earlier ones.
+func parseSortKeys(value string) ([]SortKey, error) {
+	var keys []SortKey
+	for _, part := range strings.Split(value, ",") {
+		part = strings.TrimSpace(part)
+		key := SortKey{}
+		if strings.HasPrefix(part, "-") {
+			key.Reverse = true
+			part = part[1:]
+		}
+		field, ok := sortFieldAliases[strings.ToLower(part)]
+		if !ok {
+			return nil, fmt.Errorf("unknown sort key %q (expected date, score, domain or length)", part)
+		}
+		key.Field = field
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// sortResults sorts results in place by each key in turn. Results missing a
+// date or length always sort after those that have one.
+func sortResults(results []SearchResult, keys []SortKey) {
+	sort.SliceStable(results, func(i, j int) bool {
+		for _, key := range keys {
+			if cmp := compareResults(&results[i], &results[j], key); cmp != 0 {
+				return cmp < 0
+			}
+		}
+		return false
+	})
+}
+
+// compareResults returns a negative number when a sorts before b under key
+func compareResults(a, b *SearchResult, key SortKey) int {
+	cmp := 0
+	switch key.Field {
+	case "date":
+		ta, tb := a.publishedTime(), b.publishedTime()
+		if ta.IsZero() || tb.IsZero() {
+			return missingLast(ta.IsZero(), tb.IsZero())
+		}
+		if ta.After(tb) {
+			cmp = -1
+		} else if tb.After(ta) {
+			cmp = 1
+		}
+	case "score":
+		if sa, sb := a.rankedScore(), b.rankedScore(); sa > sb {
+			cmp = -1
+		} else if sa < sb {
+			cmp = 1
+		}
+	case "domain":
+		cmp = strings.Compare(a.BaseDomain, b.BaseDomain)
+	case "length":
+		if a.Length == 0 || b.Length == 0 {
+			return missingLast(a.Length == 0, b.Length == 0)
+		}
+		cmp = b.Length - a.Length
+	}
+
+	if key.Reverse {
+		return -cmp
+	}
+	return cmp
+}
+
+// missingLast orders a present value before a missing one
+func missingLast(aMissing, bMissing bool) int {
+	switch {
+	case aMissing && !bMissing:
+		return 1
+	case bMissing && !aMissing:
+		return -1
+	}
+	return 0
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseSortKeys(t *testing.T) {
+	keys, err := parseSortKeys("-date, Score,site,length")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []SortKey{{Field: "date", Reverse: true}, {Field: "score"}, {Field: "domain"}, {Field: "length"}}
+	if !reflect.DeepEqual(keys, want) {
+		t.Errorf("keys %+v, want %+v", keys, want)
+	}
+
+	for _, value := range []string{"popularity", "date,-views", "", "date,", "--date"} {
+		if _, err := parseSortKeys(value); err == nil {
+			t.Errorf("%q: no error", value)
+		}
+	}
+}
+
+func TestSortResults(t *testing.T) {
+	results := []SearchResult{
+		{URL: "old-b", Date: "2023-01-01", BaseDomain: "b.com", Score: 0.9, Length: 500},
+		{URL: "undated", BaseDomain: "a.com", Score: 0.8},
+		{URL: "new-a", Date: "2024-06-01", BaseDomain: "a.com", Score: 0.5, Length: 2000},
+		{URL: "old-a", Date: "2023-01-01", BaseDomain: "a.com", Score: 0.7, Length: 1000},
+	}
+	tests := []struct {
+		sort string
+		want []string
+	}{
+		// Ties on the first key are broken by the next
+		{"date,domain", []string{"new-a", "old-a", "old-b", "undated"}},
+		{"date,-domain", []string{"new-a", "old-b", "old-a", "undated"}},
+		{"domain,-score", []string{"new-a", "old-a", "undated", "old-b"}},
+		{"score", []string{"old-b", "undated", "old-a", "new-a"}},
+		{"-score", []string{"new-a", "old-a", "undated", "old-b"}},
+		// Results without a date or length stay last in both directions
+		{"-date,score", []string{"old-b", "old-a", "new-a", "undated"}},
+		{"length", []string{"new-a", "old-a", "old-b", "undated"}},
+		{"-length", []string{"old-b", "old-a", "new-a", "undated"}},
+	}
+	for _, tt := range tests {
+		keys, err := parseSortKeys(tt.sort)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sorted := append([]SearchResult(nil), results...)
+		sortResults(sorted, keys)
+		if got := resultURLs(sorted); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("sort:%s = %v, want %v", tt.sort, got, tt.want)
+		}
+	}
+}
+
+// A rank profile's score takes the place of the vector score
+func TestSortByRankScore(t *testing.T) {
+	results := []SearchResult{
+		{URL: "a", Score: 0.9, RankScore: 0.2},
+		{URL: "b", Score: 0.1, RankScore: 0.6},
+	}
+	sortResults(results, []SortKey{{Field: "score"}})
+	if got := resultURLs(results); !reflect.DeepEqual(got, []string{"b", "a"}) {
+		t.Errorf("sorted %v, want by rank score", got)
+	}
+}
+
+func TestMissingLast(t *testing.T) {
+	tests := []struct {
+		aMissing, bMissing bool
+		want               int
+	}{
+		{false, false, 0},
+		{true, true, 0},
+		{true, false, 1},
+		{false, true, -1},
+	}
+	for _, tt := range tests {
+		if got := missingLast(tt.aMissing, tt.bMissing); got != tt.want {
+			t.Errorf("missingLast(%v, %v) = %d, want %d", tt.aMissing, tt.bMissing, got, tt.want)
+		}
+	}
+}
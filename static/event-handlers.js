@@ -99,6 +99,20 @@ window.addEventListener('popstate', function(event) {
         sortCheckbox.checked = sortByTime;
     }
 
+    // Update topic grouping state
+    groupByTopic = urlParams.has('clusters');
+    const clusterCheckbox = document.getElementById('cluster-checkbox');
+    if (clusterCheckbox) {
+        clusterCheckbox.checked = groupByTopic;
+    }
+
+    // Update trend sparkline state
+    showTrend = urlParams.has('trend');
+    const trendCheckbox = document.getElementById('trend-checkbox');
+    if (trendCheckbox) {
+        trendCheckbox.checked = showTrend;
+    }
+
     // Update UI state based on URL parameters
     if (query) {
         // Switch to search state if we have a query
@@ -204,6 +218,20 @@ function initializePage() {
         sortCheckbox.checked = sortByTime;
     }
 
+    // Update topic grouping state
+    groupByTopic = urlParams.has('clusters');
+    const clusterCheckbox = document.getElementById('cluster-checkbox');
+    if (clusterCheckbox) {
+        clusterCheckbox.checked = groupByTopic;
+    }
+
+    // Update trend sparkline state
+    showTrend = urlParams.has('trend');
+    const trendCheckbox = document.getElementById('trend-checkbox');
+    if (trendCheckbox) {
+        trendCheckbox.checked = showTrend;
+    }
+
     if (query) {
         // We have a query, set up search state
         if (initialState) initialState.style.display = 'none';
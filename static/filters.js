@@ -6,6 +6,8 @@ function updateFilterVisibility(skipTimeDefault = false) {
     const contentGroup = document.getElementById('content-filter-group');
     const timeGroup = document.getElementById('time-filter-group');
     const sortGroup = document.getElementById('sort-filter-group');
+    const clusterGroup = document.getElementById('cluster-filter-group');
+    const trendGroup = document.getElementById('trend-filter-group');
     const timeFilter = document.getElementById('time-filter');
     const filtersBar = document.querySelector('.filters');
 
@@ -19,6 +21,8 @@ function updateFilterVisibility(skipTimeDefault = false) {
         if (contentGroup) contentGroup.style.display = 'none';
         if (timeGroup) timeGroup.style.display = 'none';
         if (sortGroup) sortGroup.style.display = 'none';
+        if (clusterGroup) clusterGroup.style.display = 'none';
+        if (trendGroup) trendGroup.style.display = 'none';
         if (filtersBar) filtersBar.style.display = 'none';
     } else if (currentSearchType === 'sites') {
         // RSS Feeds: show toggle posts and export buttons, hide content, time and sort filters, show filters bar
@@ -27,6 +31,8 @@ function updateFilterVisibility(skipTimeDefault = false) {
         if (contentGroup) contentGroup.style.display = 'none';
         if (timeGroup) timeGroup.style.display = 'none';
         if (sortGroup) sortGroup.style.display = 'none';
+        if (clusterGroup) clusterGroup.style.display = 'none';
+        if (trendGroup) trendGroup.style.display = 'none';
         if (filtersBar) filtersBar.style.display = 'flex';
     } else {
         // Posts: hide toggle posts and export buttons, show content, time and sort filters, show filters bar
@@ -35,6 +41,8 @@ function updateFilterVisibility(skipTimeDefault = false) {
         if (contentGroup) contentGroup.style.display = 'flex';
         if (timeGroup) timeGroup.style.display = 'flex';
         if (sortGroup) sortGroup.style.display = 'flex';
+        if (clusterGroup) clusterGroup.style.display = 'flex';
+        if (trendGroup) trendGroup.style.display = 'flex';
         if (filtersBar) filtersBar.style.display = 'flex';
     }
 }
@@ -71,6 +79,28 @@ function toggleSort() {
     }
 }
 
+function toggleClusters() {
+    const checkbox = document.getElementById('cluster-checkbox');
+    groupByTopic = checkbox.checked;
+
+    // Re-run search grouped (or ungrouped) by topic
+    const query = searchInput?.value?.trim();
+    if (query) {
+        performSearch();
+    }
+}
+
+function toggleTrend() {
+    const checkbox = document.getElementById('trend-checkbox');
+    showTrend = checkbox.checked;
+
+    // Re-run search with (or without) the trend sparkline
+    const query = searchInput?.value?.trim();
+    if (query) {
+        performSearch();
+    }
+}
+
 function exportOPML() {
     const query = (searchInput?.value || initialSearch?.value || '').trim();
     if (!query) {
@@ -31,6 +31,16 @@ function searchMoreLike(url) {
     performSearch();
 }
 
+function refineSearch(operator) {
+    // Narrow the current search by adding a facet's operator to the query
+    const query = (searchInput?.value || initialSearch?.value || '').trim();
+    const newQuery = query ? query + ' ' + operator : operator;
+    if (searchInput) searchInput.value = newQuery;
+    if (initialSearch) initialSearch.value = newQuery;
+
+    performSearch();
+}
+
 function searchSimilarBlogs(domain) {
     // Clean the domain to remove https:// etc for blog similarity
     const cleanDomain = cleanURL(domain);
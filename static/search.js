@@ -14,9 +14,10 @@ function switchToSearchState(query) {
     updateFilterVisibility();
 }
 
-function performSearch() {
+function performSearch(cursor = '') {
     const query = (searchInput?.value || initialSearch?.value || '').trim();
     if (!query) return;
+    currentCursor = cursor;
 
     if (loadingDiv) loadingDiv.style.display = 'block';
     if (resultsDiv) resultsDiv.innerHTML = '';
@@ -38,11 +39,43 @@ function performSearch() {
         params.set('sort', 'time');
     }
 
+    // Group posts into five topics when enabled
+    if (currentSearchType === 'pages' && groupByTopic) {
+        params.set('clusters', '5');
+    }
+
+    // Keep the trend sparkline in the URL so it survives reloads
+    if (currentSearchType === 'pages' && showTrend) {
+        params.set('trend', 'true');
+    }
+
+    // Ask for facet counts to show as refinements on the first page only;
+    // later pages keep showing them, as they describe the whole search
+    if (!currentCursor) {
+        params.set('facets', 'true');
+    }
+
+    // Add pagination cursor when paging through results
+    if (currentCursor) {
+        params.set('cursor', currentCursor);
+    }
+
     fetch('/api/search?' + params.toString())
         .then(response => response.json())
         .then(data => {
             if (loadingDiv) loadingDiv.style.display = 'none';
+            if (data.unavailable) {
+                displayUnavailable();
+                return;
+            }
+            if (data.errors) {
+                displayQueryErrors(data.errors);
+                return;
+            }
             displayResults(data);
+            if (currentSearchType === 'pages' && showTrend && !currentCursor) {
+                loadTrend(query);
+            }
             updateURL(params);
         })
         .catch(error => {
@@ -68,54 +101,37 @@ function displayResults(data) {
                   '<path d="M6.503 20.752c0 1.794-1.456 3.248-3.251 3.248S0 22.546 0 20.752s1.456-3.248 3.252-3.248 3.251 1.454 3.251 3.248zM1.677 6.155v4.301c7.017 0 12.696 5.679 12.696 12.696h4.301c0-9.404-7.593-17-17-17zM1.677.003v4.301C12.083 4.304 20.321 12.54 20.321 23h4.301C24.622 11.228 13.395.003 1.677.003z"/>' +
                   '</svg>RSS</a></div>';
 
-        data.results.forEach(result => {
-            // If this is a feed search with posts toggled, show posts instead of feeds
-            if (result.is_feed_search && showPosts && result.latest_post_title) {
-                // Display as a post result
-                const postDateStr = result.latest_post_date ? ` • ${result.latest_post_date}` : '';
-                html += `<div class="result-item page-result">
-                    <div class="result-url">${result.basedomain}${postDateStr}</div>
-                    <div class="result-title">
-                        <a href="${result.latest_post_url}" target="_blank">${result.latest_post_title}</a>
-                    </div>
-                    <div class="result-snippet">${result.latest_post_snippet || ''}</div>
-                    <div class="result-meta"></div>
-                    <div class="result-actions">
-                        <a class="action-link" onclick="searchMoreLike('${result.latest_post_url}')">Similar posts</a>
-                        <a class="action-link" onclick="searchSimilarBlogs('${result.original_domain}')">Similar blogs</a>
-                        <a class="action-link" onclick="searchFromSite('${result.original_domain}')">More from site</a>
-                    </div>
-                </div>`;
-            } else if (result.is_feed_search && showPosts && !result.latest_post_title) {
-                // Skip feeds that don't have latest posts when in posts mode
-                return;
-            } else {
-                // Normal display (feeds or regular posts)
-                const siteClass = result.is_feed_search ? 'site-result' : 'page-result';
-                const dateStr = (!result.is_feed_search && result.date) ? ` • ${result.date}` : '';
-                html += `<div class="result-item ${siteClass}">
-                    <div class="result-url">${result.basedomain}${dateStr}</div>
-                    <div class="result-title"><a href="${result.url}" target="_blank">${result.title}</a></div>
-                    <div class="result-snippet">${result.subtitle}</div>
-                    <div class="result-meta"></div>
-                    <div class="result-actions">`;
-
-                if (!result.is_feed_search) {
-                    html += `<a class="action-link" onclick="searchMoreLike('${result.url}')">Similar posts</a>`;
-                    html += `<a class="action-link" onclick="searchSimilarBlogs('${result.original_domain}')">Similar blogs</a>`;
-                } else {
-                    html += `<a class="action-link" onclick="searchSimilarBlogs('${result.original_domain}')">Similar blogs</a>`;
-                }
-                html += `<a class="action-link" onclick="searchFromSite('${result.original_domain}')">More from site</a>`;
-
-                if (result.is_feed_search && result.rss_url) {
-                    html += `<a href="${result.rss_url}" class="rss-link" target="_blank">📡 RSS Feed</a>`;
-                }
-                html += `</div></div>`;
+        if (!currentCursor) currentFacets = data.facets || [];
+        html += renderFacets(currentFacets);
+
+        if (data.clusters && data.clusters.length > 0) {
+            data.clusters.forEach(cluster => {
+                html += `<div class="result-cluster"><div class="cluster-label">${escapeHTML(cluster.label)} ` +
+                        `<span class="cluster-count">${cluster.results.length}</span></div>`;
+                cluster.results.forEach(result => {
+                    html += renderResult(result);
+                });
+                html += '</div>';
+            });
+        } else {
+            data.results.forEach(result => {
+                html += renderResult(result);
+            });
+        }
+
+        if (data.prev_cursor || data.next_cursor) {
+            html += '<div class="pagination">';
+            if (data.prev_cursor) {
+                html += `<a class="page-link" onclick="performSearch('${data.prev_cursor}')">&larr; Previous</a>`;
             }
-        });
+            if (data.next_cursor) {
+                html += `<a class="page-link" onclick="performSearch('${data.next_cursor}')">Next &rarr;</a>`;
+            }
+            html += '</div>';
+        }
 
         resultsDiv.innerHTML = html;
+        window.scrollTo(0, 0);
     } else {
         const query = searchInput?.value || initialSearch?.value || '';
         resultsDiv.innerHTML = `<div class="no-results">
@@ -125,6 +141,100 @@ function displayResults(data) {
     }
 }
 
+function renderResult(result) {
+    let html = '';
+    // If this is a feed search with posts toggled, show posts instead of feeds
+    if (result.is_feed_search && showPosts && result.latest_post_title) {
+        // Display as a post result
+        const postDateStr = result.latest_post_date ? ` • ${result.latest_post_date}` : '';
+        html += `<div class="result-item page-result">
+            <div class="result-url">${result.basedomain}${postDateStr}</div>
+            <div class="result-title">
+                <a href="${result.latest_post_url}" target="_blank">${result.latest_post_title}</a>
+            </div>
+            <div class="result-snippet">${result.latest_post_snippet || ''}</div>
+            <div class="result-meta"></div>
+            <div class="result-actions">
+                <a class="action-link" onclick="searchMoreLike('${result.latest_post_url}')">Similar posts</a>
+                <a class="action-link" onclick="searchSimilarBlogs('${result.original_domain}')">Similar blogs</a>
+                <a class="action-link" onclick="searchFromSite('${result.original_domain}')">More from site</a>
+            </div>
+        </div>`;
+    } else if (result.is_feed_search && showPosts && !result.latest_post_title) {
+        // Skip feeds that don't have latest posts when in posts mode
+        return '';
+    } else {
+        // Normal display (feeds or regular posts)
+        const siteClass = result.is_feed_search ? 'site-result' : 'page-result';
+        const dateStr = (!result.is_feed_search && result.date) ? ` • ${result.date}` : '';
+        // Highlights are escaped by the server apart from their <mark> tags
+        const title = result.highlights ? result.highlights.title : escapeHTML(result.title);
+        const snippet = result.highlights ? result.highlights.snippet : escapeHTML(result.subtitle);
+        html += `<div class="result-item ${siteClass}">
+            <div class="result-url">${result.basedomain}${dateStr}</div>
+            <div class="result-title"><a href="${result.url}" target="_blank">${title}</a></div>
+            <div class="result-snippet">${snippet}</div>
+            <div class="result-meta"></div>
+            <div class="result-actions">`;
+
+        if (!result.is_feed_search) {
+            html += `<a class="action-link" onclick="searchMoreLike('${result.url}')">Similar posts</a>`;
+            html += `<a class="action-link" onclick="searchSimilarBlogs('${result.original_domain}')">Similar blogs</a>`;
+        } else {
+            html += `<a class="action-link" onclick="searchSimilarBlogs('${result.original_domain}')">Similar blogs</a>`;
+        }
+        html += `<a class="action-link" onclick="searchFromSite('${result.original_domain}')">More from site</a>`;
+
+        if (result.is_feed_search && result.rss_url) {
+            html += `<a href="${result.rss_url}" class="rss-link" target="_blank">📡 RSS Feed</a>`;
+        }
+        html += `</div></div>`;
+    }
+    return html;
+}
+
+function renderFacets(facets) {
+    if (!facets || facets.length === 0) return '';
+
+    let html = '<div class="facets">';
+    facets.forEach(facet => {
+        html += `<div class="facet-group"><span class="facet-label">${escapeHTML(facet.label)}</span>`;
+        facet.values.forEach(value => {
+            html += `<a class="facet-link" data-refine="${escapeHTML(value.refine).replace(/"/g, '&quot;')}" onclick="refineSearch(this.dataset.refine)">` +
+                    `${escapeHTML(value.value)} <span class="facet-count">${value.count}</span></a>`;
+        });
+        html += '</div>';
+    });
+    html += '</div>';
+    return html;
+}
+
+function escapeHTML(text) {
+    const div = document.createElement('div');
+    div.textContent = text;
+    return div.innerHTML;
+}
+
+function displayQueryErrors(errors) {
+    if (!resultsDiv) return;
+
+    let html = '<div class="query-errors"><p>There is a problem with your query:</p><ul>';
+    errors.forEach(err => {
+        const operator = err.operator ? `<code>${escapeHTML(err.operator)}:</code> ` : '';
+        html += `<li>${operator}${escapeHTML(err.message)} (at character ${err.offset})</li>`;
+    });
+    html += '</ul></div>';
+    resultsDiv.innerHTML = html;
+}
+
+function displayUnavailable() {
+    if (!resultsDiv) return;
+
+    resultsDiv.innerHTML = '<div class="search-unavailable">' +
+        '<p>Search is temporarily unavailable.</p>' +
+        '<p>One of the services behind it isn\'t responding. Please try again in a minute.</p></div>';
+}
+
 function updateURL(params) {
     // Always use root path for searches (not custom RSS)
     const newURL = '/?' + params.toString();
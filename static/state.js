@@ -3,6 +3,10 @@ let currentSearchType = '{{.SearchType}}' || 'pages';
 let searchTimeout;
 let showPosts = false;
 let sortByTime = false;
+let groupByTopic = false;
+let showTrend = false;
+let currentCursor = '';
+let currentFacets = [];
 
 // DOM Elements
 const initialState = document.getElementById('initial-state');
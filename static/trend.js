@@ -0,0 +1,55 @@
+// Topic Trend Sparkline
+
+function loadTrend(query) {
+    if (!resultsDiv) return;
+    resultsDiv.insertAdjacentHTML('afterbegin', '<div id="trend-sparkline" class="trend-sparkline">Loading trend...</div>');
+
+    const params = new URLSearchParams({
+        qry: query,
+        content: document.getElementById('content-filter')?.value || ''
+    });
+
+    fetch('/api/trend?' + params.toString())
+        .then(response => response.json())
+        .then(data => {
+            const container = document.getElementById('trend-sparkline');
+            if (!container) return;
+            if (!data.buckets || data.buckets.length === 0) {
+                container.remove();
+                return;
+            }
+            container.innerHTML = renderSparkline(data);
+        })
+        .catch(error => {
+            console.error('Trend error:', error);
+            document.getElementById('trend-sparkline')?.remove();
+        });
+}
+
+function renderSparkline(data) {
+    const width = 240;
+    const height = 36;
+    const buckets = data.buckets;
+    const max = Math.max(1, ...buckets.map(bucket => bucket.count));
+    const step = buckets.length > 1 ? width / (buckets.length - 1) : width;
+    const y = count => height - 2 - (count / max) * (height - 4);
+
+    const points = buckets.map((bucket, i) => `${(i * step).toFixed(1)},${y(bucket.count).toFixed(1)}`).join(' ');
+
+    // One hover target per bucket, describing its count and top sites
+    let targets = '';
+    buckets.forEach((bucket, i) => {
+        const sites = bucket.top_domains.map(d => `${d.domain} (${d.count})`).join(', ');
+        let label = `${bucket.start}: ${bucket.count}${bucket.capped ? '+' : ''} posts`;
+        if (sites) label += ` - ${sites}`;
+        if (bucket.error) label = `${bucket.start}: ${bucket.error}`;
+        const x = Math.max(0, i * step - step / 2);
+        targets += `<rect x="${x.toFixed(1)}" y="0" width="${step.toFixed(1)}" height="${height}" fill="transparent">` +
+                   `<title>${escapeHTML(label)}</title></rect>`;
+    });
+
+    return `<span class="trend-label">Posts per ${escapeHTML(data.interval)} since ${escapeHTML(data.since)}</span>` +
+           `<svg class="trend-svg" width="${width}" height="${height}" viewBox="0 0 ${width} ${height}">` +
+           `<polyline points="${points}" fill="none" stroke="#1a73e8" stroke-width="1.5"/>${targets}</svg>` +
+           `<span class="trend-total">${data.total} total</span>`;
+}
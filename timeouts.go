@@ -0,0 +1,57 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+)
+
+// StageTimeouts bounds each stage of a search. Search covers the whole
+// request; the others bound each upstream call made within it. When a
+// deadline passes, the calls in flight are cancelled.
+type StageTimeouts struct {
+	Search   time.Duration
+	Embed    time.Duration
+	Retrieve time.Duration
+	Rerank   time.Duration
+	Enrich   time.Duration
+}
+
+// defaultStageTimeouts keeps the whole request within the 30 seconds the
+// clients used to allow for a single call
+var defaultStageTimeouts = StageTimeouts{
+	Search:   30 * time.Second,
+	Embed:    10 * time.Second,
+	Retrieve: 10 * time.Second,
+	Rerank:   10 * time.Second,
+	Enrich:   10 * time.Second,
+}
+
+// loadStageTimeouts reads SEARCH_TIMEOUT, EMBED_TIMEOUT, RETRIEVE_TIMEOUT,
+// RERANK_TIMEOUT and ENRICH_TIMEOUT as Go durations such as 500ms or 5s,
+// falling back to the defaults
+func loadStageTimeouts() (StageTimeouts, error) {
+	timeouts := defaultStageTimeouts
+	stages := []struct {
+		env string
+		d   *time.Duration
+	}{
+		{"SEARCH_TIMEOUT", &timeouts.Search},
+		{"EMBED_TIMEOUT", &timeouts.Embed},
+		{"RETRIEVE_TIMEOUT", &timeouts.Retrieve},
+		{"RERANK_TIMEOUT", &timeouts.Rerank},
+		{"ENRICH_TIMEOUT", &timeouts.Enrich},
+	}
+	for _, stage := range stages {
+		value := os.Getenv(stage.env)
+		if value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil || d <= 0 {
+			return timeouts, fmt.Errorf("invalid %s %q (expected a duration such as 5s)", stage.env, value)
+		}
+		*stage.d = d
+	}
+	return timeouts, nil
+}
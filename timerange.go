@@ -0,0 +1,124 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// relativeUnits maps duration suffixes to their length
+var relativeUnits = map[string]time.Duration{
+	"h": time.Hour,
+	"d": 24 * time.Hour,
+	"w": 7 * 24 * time.Hour,
+	"m": 30 * 24 * time.Hour,
+	"y": 365 * 24 * time.Hour,
+}
+
+// parseTimeBound converts a since:/until: value into a unix timestamp. The
+// value may be one of the period labels such as last_week, a duration back
+// from now such as 6h, 10d, 2w, 3m or 1y, or a date such as 2024, 2024-06,
+// 2024-06-30 or an RFC 3339 timestamp. Dates cover their whole period, so an
+// upper bound of 2024-06 ends at the start of July.
+func parseTimeBound(value string, now time.Time, upper bool) (int64, error) {
+	if seconds, ok := getSinceMapping(value); ok {
+		return now.Unix() - seconds, nil
+	}
+	if d, ok := parseRelativeDuration(value); ok {
+		return now.Add(-d).Unix(), nil
+	}
+	if start, end, ok := parseDatePeriod(value); ok {
+		if upper {
+			return end.Unix(), nil
+		}
+		return start.Unix(), nil
+	}
+	return 0, fmt.Errorf("unrecognised time %q (expected a period such as last_week, a duration such as 10d or a date such as 2024-01-31)", value)
+}
+
+// parseRelativeDuration parses values such as 6h or 10d
+func parseRelativeDuration(value string) (time.Duration, bool) {
+	if len(value) < 2 {
+		return 0, false
+	}
+	unit, ok := relativeUnits[value[len(value)-1:]]
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(value[:len(value)-1])
+	if err != nil || n <= 0 {
+		return 0, false
+	}
+	return time.Duration(n) * unit, true
+}
+
+// parseDatePeriod parses a year, month, day or timestamp in UTC and returns
+// the half-open interval it covers
+func parseDatePeriod(value string) (time.Time, time.Time, bool) {
+	periods := []struct {
+		layout string
+		years  int
+		months int
+		days   int
+	}{
+		{"2006", 1, 0, 0},
+		{"2006-01", 0, 1, 0},
+		{"2006-01-02", 0, 0, 1},
+	}
+	for _, p := range periods {
+		if t, err := time.Parse(p.layout, value); err == nil {
+			return t, t.AddDate(p.years, p.months, p.days), true
+		}
+	}
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, t, true
+	}
+	return time.Time{}, time.Time{}, false
+}
+
+// parseTimeRange parses a between: value of the form start..end, where
+// either side may be left open
+func parseTimeRange(value string, now time.Time) (map[string]interface{}, error) {
+	parts := strings.SplitN(value, "..", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("expected a range such as 2023-01..2023-03")
+	}
+
+	cond := make(map[string]interface{})
+	var start, end int64
+	var err error
+	if parts[0] != "" {
+		if start, err = parseTimeBound(parts[0], now, false); err != nil {
+			return nil, err
+		}
+		cond["$gte"] = start
+	}
+	if parts[1] != "" {
+		if end, err = parseTimeBound(parts[1], now, true); err != nil {
+			return nil, err
+		}
+		cond["$lt"] = end
+	}
+
+	if len(cond) == 0 {
+		return nil, fmt.Errorf("range needs a start or an end")
+	}
+	if parts[0] != "" && parts[1] != "" && start >= end {
+		return nil, fmt.Errorf("range %s is empty", value)
+	}
+	return cond, nil
+}
+
+// timeParamBounds converts the time URL parameter into since and until
+// values. The select box sends bare labels such as week, while API callers
+// may use any since: value or a start..end range.
+func timeParamBounds(timeFilter string) (string, string) {
+	if parts := strings.SplitN(timeFilter, "..", 2); len(parts) == 2 {
+		return parts[0], parts[1]
+	}
+	if _, ok := getSinceMapping("last_" + timeFilter); ok {
+		return "last_" + timeFilter, ""
+	}
+	return timeFilter, ""
+}
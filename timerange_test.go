@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseTimeBound(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+	day := func(y int, m time.Month, d int) int64 {
+		return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Unix()
+	}
+	tests := []struct {
+		value string
+		upper bool
+		want  int64
+	}{
+		{"last_week", false, now.Unix() - 7*24*60*60},
+		{"6h", false, now.Add(-6 * time.Hour).Unix()},
+		{"10d", false, now.AddDate(0, 0, -10).Unix()},
+		{"2w", true, now.AddDate(0, 0, -14).Unix()},
+		{"2024", false, day(2024, 1, 1)},
+		{"2024", true, day(2025, 1, 1)},
+		{"2024-06", false, day(2024, 6, 1)},
+		{"2024-06", true, day(2024, 7, 1)},
+		{"2024-06-30", true, day(2024, 7, 1)},
+		{"2024-12-31", true, day(2025, 1, 1)},
+		{"2024-06-30T08:00:00Z", true, time.Date(2024, 6, 30, 8, 0, 0, 0, time.UTC).Unix()},
+	}
+	for _, tt := range tests {
+		got, err := parseTimeBound(tt.value, now, tt.upper)
+		if err != nil {
+			t.Errorf("%q: unexpected error: %v", tt.value, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q (upper %v) = %d, want %d", tt.value, tt.upper, got, tt.want)
+		}
+	}
+
+	for _, value := range []string{"lastweek", "0d", "-3d", "5x", "d", "2024-13", "2024-02-30"} {
+		if _, err := parseTimeBound(value, now, false); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestParseTimeRange(t *testing.T) {
+	now := time.Date(2024, 6, 15, 12, 0, 0, 0, time.UTC)
+
+	cond, err := parseTimeRange("2023-01..2023-03", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cond["$gte"] != time.Date(2023, 1, 1, 0, 0, 0, 0, time.UTC).Unix() ||
+		cond["$lt"] != time.Date(2023, 4, 1, 0, 0, 0, 0, time.UTC).Unix() {
+		t.Errorf("closed range = %v", cond)
+	}
+
+	cond, err = parseTimeRange("..2024", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cond["$gte"]; ok || len(cond) != 1 {
+		t.Errorf("open start = %v", cond)
+	}
+
+	cond, err = parseTimeRange("30d..", now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := cond["$lt"]; ok || len(cond) != 1 {
+		t.Errorf("open end = %v", cond)
+	}
+
+	for _, value := range []string{"2024", "..", "2024-03..2024-01", "2024..nope"} {
+		if _, err := parseTimeRange(value, now); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestTimeParamBounds(t *testing.T) {
+	tests := []struct {
+		param, since, until string
+	}{
+		{"week", "last_week", ""},
+		{"3months", "last_3months", ""},
+		{"yesterday", "yesterday", ""},
+		{"10d", "10d", ""},
+		{"2024-01..2024-03", "2024-01", "2024-03"},
+		{"..2024", "", "2024"},
+	}
+	for _, tt := range tests {
+		since, until := timeParamBounds(tt.param)
+		if since != tt.since || until != tt.until {
+			t.Errorf("%q = (%q, %q), want (%q, %q)", tt.param, since, until, tt.since, tt.until)
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Trend intervals
+const (
+	trendIntervalWeek  = "week"
+	trendIntervalMonth = "month"
+)
+
+// Trend defaults and limits
+const (
+	defaultTrendSince   = "1y"
+	defaultTrendDomains = 3
+	maxTrendDomains     = 10
+	maxTrendBuckets     = 156
+	// trendSampleSize is the number of nearest posts examined in each
+	// bucket, so a count this high is a lower bound
+	trendSampleSize = 100
+	// defaultTrendSimilarity is the similarity to the query a post needs to
+	// be counted
+	defaultTrendSimilarity = 0.5
+	trendWorkers           = 8
+)
+
+// TrendRequest describes a topic timeline. Search selects the posts, and
+// the interval and range lay out the buckets they are counted in.
+type TrendRequest struct {
+	Search        *SearchRequest
+	Interval      string
+	Since         string
+	Until         string
+	Domains       int
+	MinSimilarity float64
+}
+
+// TrendResponse counts the posts matching a query in each bucket
+type TrendResponse struct {
+	Query         string        `json:"query"`
+	Interval      string        `json:"interval"`
+	Since         string        `json:"since"`
+	Until         string        `json:"until"`
+	MinSimilarity float64       `json:"min_similarity"`
+	Total         int           `json:"total"`
+	Buckets       []TrendBucket `json:"buckets"`
+	TimeTaken     float64       `json:"time_taken"`
+}
+
+// TrendBucket is one week or month of a trend. Capped is set when the count
+// reached the sample size, and Error when the bucket couldn't be counted.
+type TrendBucket struct {
+	Start      string        `json:"start"`
+	End        string        `json:"end"`
+	Count      int           `json:"count"`
+	Capped     bool          `json:"capped,omitempty"`
+	TopDomains []DomainCount `json:"top_domains"`
+	Error      string        `json:"error,omitempty"`
+
+	start, end time.Time
+}
+
+// DomainCount is the number of posts a site contributed to a bucket
+type DomainCount struct {
+	Domain string `json:"domain"`
+	Count  int    `json:"count"`
+}
+
+// trendRequestFromParams builds a TrendRequest from URL query parameters:
+// the search parameters plus interval, since, until, domains and
+// min_similarity
+func trendRequestFromParams(params map[string][]string) *TrendRequest {
+	search := searchRequestFromParams(params)
+	search.Namespace = corpusPosts
+	treq := &TrendRequest{
+		Search:   search,
+		Interval: getStringDefault(getParam(params, "interval"), trendIntervalMonth),
+		Since:    getStringDefault(getParam(params, "since"), defaultTrendSince),
+		Until:    getParam(params, "until"),
+		Domains:  search.intParam(params, "domains"),
+	}
+	treq.MinSimilarity = defaultTrendSimilarity
+	if value := getParam(params, "min_similarity"); value != "" {
+		similarity, err := strconv.ParseFloat(value, 64)
+		if err != nil || similarity < -1 || similarity > 1 {
+			search.paramErrs = append(search.paramErrs, &QueryError{Field: "min_similarity", Message: fmt.Sprintf("%q must be a number from -1 to 1", value)})
+		}
+		treq.MinSimilarity = similarity
+	}
+	return treq
+}
+
+// buckets lays out the weeks (starting Monday) or months, in UTC, covering
+// the requested range
+func (treq *TrendRequest) buckets(now time.Time) ([]TrendBucket, error) {
+	var errs QueryErrors
+	since, err := parseTimeBound(treq.Since, now, false)
+	if err != nil {
+		errs = append(errs, &QueryError{Field: "since", Message: err.Error()})
+	}
+	until := now.Unix()
+	if treq.Until != "" {
+		if until, err = parseTimeBound(treq.Until, now, true); err != nil {
+			errs = append(errs, &QueryError{Field: "until", Message: err.Error()})
+		}
+	}
+	if treq.Interval != trendIntervalWeek && treq.Interval != trendIntervalMonth {
+		errs = append(errs, &QueryError{Field: "interval", Message: fmt.Sprintf("unknown interval %q (expected week or month)", treq.Interval)})
+	}
+	if len(errs) > 0 {
+		return nil, errs
+	}
+	if until <= since {
+		return nil, QueryErrors{{Field: "until", Message: "the range ends before it starts"}}
+	}
+
+	start := time.Unix(since, 0).UTC()
+	end := time.Unix(until, 0).UTC()
+	var next func(t time.Time) time.Time
+	if treq.Interval == trendIntervalWeek {
+		start = time.Date(start.Year(), start.Month(), start.Day()-(int(start.Weekday())+6)%7, 0, 0, 0, 0, time.UTC)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 0, 7) }
+	} else {
+		start = time.Date(start.Year(), start.Month(), 1, 0, 0, 0, 0, time.UTC)
+		next = func(t time.Time) time.Time { return t.AddDate(0, 1, 0) }
+	}
+
+	var buckets []TrendBucket
+	for t := start; t.Before(end); t = next(t) {
+		if len(buckets) == maxTrendBuckets {
+			return nil, QueryErrors{{Field: "since", Message: fmt.Sprintf("the range spans more than %d %ss", maxTrendBuckets, treq.Interval)}}
+		}
+		buckets = append(buckets, TrendBucket{
+			Start: t.Format("2006-01-02"),
+			End:   next(t).Format("2006-01-02"),
+			start: t,
+			end:   next(t),
+		})
+	}
+	return buckets, nil
+}
+
+// domains returns the number of top domains to list per bucket
+func (treq *TrendRequest) domains() int {
+	switch {
+	case treq.Domains <= 0:
+		return defaultTrendDomains
+	case treq.Domains > maxTrendDomains:
+		return maxTrendDomains
+	}
+	return treq.Domains
+}
+
+// performTrend counts the posts matching a query in each bucket of a date
+// range. Each bucket runs the query with an extra time filter and counts the
+// nearest posts that are similar enough to the query. Query errors are
+// returned as QueryErrors; other errors mean the query couldn't be embedded.
+// Like a search, the trend is cancelled with ctx or after the search timeout.
+func (app *App) performTrend(ctx context.Context, treq *TrendRequest) (TrendResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, app.timeouts.Search)
+	defer cancel()
+	start := time.Now()
+	parsedQuery, err := treq.Search.parse()
+	if err != nil {
+		return TrendResponse{}, err
+	}
+	if parsedQuery.Mode != searchModeVector {
+		return TrendResponse{}, QueryErrors{{Operator: "mode", Message: "trends count posts by vector similarity, so only mode:vector is supported"}}
+	}
+	if parsedQuery.Text == "" && !parsedQuery.IsLike && len(parsedQuery.Filters) == 0 {
+		return TrendResponse{}, QueryErrors{{Field: "qry", Message: "a trend needs a topic or a filter"}}
+	}
+
+	corpus := corpusFor(false)
+	if corpus.Fields.Time == "" {
+		return TrendResponse{}, QueryErrors{{Field: "since", Message: fmt.Sprintf("the %s corpus has no publish time field", corpus.Name)}}
+	}
+	buckets, err := treq.buckets(time.Now())
+	if err != nil {
+		return TrendResponse{}, err
+	}
+
+	embedding, err := app.queryEmbedding(ctx, parsedQuery)
+	if err != nil {
+		return TrendResponse{}, err
+	}
+	if parsedQuery.Negation != "" {
+		negationEmbedding, err := app.embed(ctx, parsedQuery.Negation)
+		if err != nil {
+			return TrendResponse{}, fmt.Errorf("failed to get embedding for negation: %w", err)
+		}
+		embedding = adjustForNegation(embedding, negationEmbedding, parsedQuery.NegationWeight)
+	}
+
+	// Queries that only filter use a generic embedding, so every post counts
+	minSimilarity := treq.MinSimilarity
+	if parsedQuery.Text == "" && !parsedQuery.IsLike {
+		minSimilarity = -1
+	}
+
+	forEachConcurrently(len(buckets), trendWorkers, func(i int) {
+		app.countTrendBucket(ctx, &buckets[i], corpus, embedding, parsedQuery.Filters, minSimilarity, treq.domains())
+	})
+
+	response := TrendResponse{
+		Query:         treq.Search.Text,
+		Interval:      treq.Interval,
+		Since:         buckets[0].Start,
+		Until:         buckets[len(buckets)-1].End,
+		MinSimilarity: minSimilarity,
+		Buckets:       buckets,
+	}
+	for _, bucket := range buckets {
+		response.Total += bucket.Count
+	}
+	response.TimeTaken = time.Since(start).Seconds()
+	return response, nil
+}
+
+// countTrendBucket counts the posts published in a bucket that are similar
+// enough to the query, and the sites that published the most of them
+func (app *App) countTrendBucket(ctx context.Context, bucket *TrendBucket, corpus *Corpus, embedding []float64, filters map[string]interface{}, minSimilarity float64, domains int) {
+	timeFilter := map[string]interface{}{
+		corpus.Fields.Time: map[string]interface{}{"$gte": bucket.start.Unix(), "$lt": bucket.end.Unix()},
+	}
+	if len(filters) > 0 {
+		timeFilter = map[string]interface{}{"$and": []interface{}{filters, timeFilter}}
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, app.timeouts.Retrieve)
+	defer cancel()
+	matches, err := corpus.client.Query(ctx, corpus.Namespace, embedding, timeFilter, trendSampleSize)
+	if err != nil {
+		log.Printf("Trend bucket %s error: %v", bucket.Start, err)
+		bucket.Error = fmt.Sprintf("count unavailable: %v", err)
+		bucket.TopDomains = []DomainCount{}
+		return
+	}
+
+	perDomain := make(map[string]int)
+	for _, match := range matches {
+		if match.Score < minSimilarity {
+			continue
+		}
+		bucket.Count++
+		if domain := cleanURL(getMetadataString(match.Metadata, corpus.Fields.BaseURL)); domain != "" {
+			perDomain[domain]++
+		}
+	}
+	bucket.Capped = bucket.Count == trendSampleSize
+
+	bucket.TopDomains = make([]DomainCount, 0, len(perDomain))
+	for domain, count := range perDomain {
+		bucket.TopDomains = append(bucket.TopDomains, DomainCount{Domain: domain, Count: count})
+	}
+	sort.Slice(bucket.TopDomains, func(i, j int) bool {
+		a, b := bucket.TopDomains[i], bucket.TopDomains[j]
+		if a.Count != b.Count {
+			return a.Count > b.Count
+		}
+		return a.Domain < b.Domain
+	})
+	if len(bucket.TopDomains) > domains {
+		bucket.TopDomains = bucket.TopDomains[:domains]
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+// bucketStarts returns the start dates of buckets
+func bucketStarts(buckets []TrendBucket) []string {
+	starts := make([]string, len(buckets))
+	for i, bucket := range buckets {
+		starts[i] = bucket.Start
+	}
+	return starts
+}
+
+func TestTrendBuckets(t *testing.T) {
+	now := time.Date(2024, 3, 20, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		interval, since, until string
+		starts                 []string
+		lastEnd                string
+	}{
+		// Weeks start on the Monday on or before since
+		{trendIntervalWeek, "2024-01-03", "2024-01-20", []string{"2024-01-01", "2024-01-08", "2024-01-15"}, "2024-01-22"},
+		{trendIntervalWeek, "2024-01-01", "2024-01-07", []string{"2024-01-01"}, "2024-01-08"},
+		// A Sunday belongs to the week that started six days before
+		{trendIntervalWeek, "2024-01-07", "2024-01-08", []string{"2024-01-01", "2024-01-08"}, "2024-01-15"},
+		// Months start on the first, and until covers its whole day or month
+		{trendIntervalMonth, "2024-01-15", "2024-03-10", []string{"2024-01-01", "2024-02-01", "2024-03-01"}, "2024-04-01"},
+		{trendIntervalMonth, "2023-12", "2024-01", []string{"2023-12-01", "2024-01-01"}, "2024-02-01"},
+		// Until defaults to now
+		{trendIntervalMonth, "2024-02-10", "", []string{"2024-02-01", "2024-03-01"}, "2024-04-01"},
+	}
+	for _, tt := range tests {
+		treq := &TrendRequest{Interval: tt.interval, Since: tt.since, Until: tt.until}
+		buckets, err := treq.buckets(now)
+		if err != nil {
+			t.Errorf("%s %s..%s: %v", tt.interval, tt.since, tt.until, err)
+			continue
+		}
+		if got := bucketStarts(buckets); !reflect.DeepEqual(got, tt.starts) {
+			t.Errorf("%s %s..%s: buckets start %v, want %v", tt.interval, tt.since, tt.until, got, tt.starts)
+			continue
+		}
+		for i := 1; i < len(buckets); i++ {
+			if buckets[i-1].End != buckets[i].Start {
+				t.Errorf("%s %s..%s: bucket %d ends %s, but the next starts %s", tt.interval, tt.since, tt.until, i-1, buckets[i-1].End, buckets[i].Start)
+			}
+		}
+		if last := buckets[len(buckets)-1]; last.End != tt.lastEnd || last.end.Format("2006-01-02") != tt.lastEnd {
+			t.Errorf("%s %s..%s: last bucket ends %s, want %s", tt.interval, tt.since, tt.until, last.End, tt.lastEnd)
+		}
+	}
+}
+
+func TestTrendBucketsLimit(t *testing.T) {
+	now := time.Date(2024, 3, 20, 15, 0, 0, 0, time.UTC)
+
+	// 2021-01-04 is a Monday, and 156 weeks later is 2024-01-01
+	treq := &TrendRequest{Interval: trendIntervalWeek, Since: "2021-01-04", Until: "2023-12-31"}
+	buckets, err := treq.buckets(now)
+	if err != nil || len(buckets) != maxTrendBuckets {
+		t.Fatalf("%d buckets, %v, want exactly %d", len(buckets), err, maxTrendBuckets)
+	}
+
+	treq.Until = "2024-01-01"
+	if _, err := treq.buckets(now); !hasFieldError(err, "since") {
+		t.Errorf("157 weeks: error %v, want one for since", err)
+	}
+}
+
+func TestTrendBucketsErrors(t *testing.T) {
+	now := time.Date(2024, 3, 20, 15, 0, 0, 0, time.UTC)
+	tests := []struct {
+		treq  TrendRequest
+		field string
+	}{
+		{TrendRequest{Interval: trendIntervalWeek, Since: "2024-02-01", Until: "2024-01-31"}, "until"},
+		{TrendRequest{Interval: trendIntervalMonth, Since: "2024-05"}, "until"},
+		{TrendRequest{Interval: "day", Since: "2024-01-01"}, "interval"},
+		{TrendRequest{Interval: trendIntervalWeek, Since: "lastweek"}, "since"},
+		{TrendRequest{Interval: trendIntervalWeek, Since: "2024-01-01", Until: "soon"}, "until"},
+	}
+	for _, tt := range tests {
+		if _, err := tt.treq.buckets(now); !hasFieldError(err, tt.field) {
+			t.Errorf("%+v: error %v, want one for %s", tt.treq, err, tt.field)
+		}
+	}
+}
+
+// hasFieldError reports whether err is a QueryErrors with one for field
+func hasFieldError(err error, field string) bool {
+	queryErrs, ok := err.(QueryErrors)
+	if !ok {
+		return false
+	}
+	for _, queryErr := range queryErrs {
+		if queryErr.Field == field {
+			return true
+		}
+	}
+	return false
+}
@@ -8,27 +8,75 @@ import (
 
 // SearchResult represents a single search result
 type SearchResult struct {
-	URL           string  `json:"url"`
-	Title         string  `json:"title"`
-	Subtitle      string  `json:"subtitle"`
-	Date          string  `json:"date"`
-	Score         float64 `json:"pcscore"`
-	BaseDomain    string  `json:"basedomain"`
-	IsFeed        bool    `json:"is_feed_search"`
-	RSSURL        string  `json:"rss_url"`
-	OriginalDomain string  `json:"original_domain"`
+	URL            string            `json:"url"`
+	Title          string            `json:"title"`
+	Subtitle       string            `json:"subtitle"`
+	Date           string            `json:"date"`
+	Score          float64           `json:"pcscore"`
+	BaseDomain     string            `json:"basedomain"`
+	IsFeed         bool              `json:"is_feed_search"`
+	RSSURL         string            `json:"rss_url"`
+	OriginalDomain string            `json:"original_domain"`
+	Length         int               `json:"length,omitempty"`
+	RankScore      float64           `json:"rank_score,omitempty"` // set when a rank: profile blends signals
+	Highlights     *ResultHighlights `json:"highlights,omitempty"`
 	// Latest post fields (only populated for feeds when include_posts=true)
 	LatestPostTitle    string `json:"latest_post_title,omitempty"`
 	LatestPostURL      string `json:"latest_post_url,omitempty"`
 	LatestPostDate     string `json:"latest_post_date,omitempty"`
 	LatestPostSnippet  string `json:"latest_post_snippet,omitempty"`
+	// LatestPosts lists the newest posts of a feed, and EnrichmentError
+	// explains why they couldn't be fetched
+	LatestPosts     []SearchResult `json:"latest_posts,omitempty"`
+	EnrichmentError string         `json:"enrichment_error,omitempty"`
+	// Feed links a post to its feed (only populated for type=all)
+	Feed *FeedLink `json:"feed,omitempty"`
+	// published is the full publication time used for sorting
+	published time.Time
+	// quality is the score metadata used by rank: profiles
+	quality float64
+	// metadata is the Pinecone metadata the result was built from
+	metadata map[string]interface{}
+	// vector is the embedding, when it was fetched for diversification or
+	// clustering
+	vector []float64
+}
+
+// publishedTime returns the publication time, falling back to the date string
+func (r *SearchResult) publishedTime() time.Time {
+	if !r.published.IsZero() {
+		return r.published
+	}
+	return parseDate(r.Date)
 }
 
 // SearchResponse represents the API response for search requests
+// TotalResults counts every candidate retrieved for the search, which
+// includes at least one page beyond the current one when more exist.
 type SearchResponse struct {
-	Results     []SearchResult `json:"results"`
-	TimeTaken   float64        `json:"time_taken"`
-	TotalResults int           `json:"total_results"`
+	Results      []SearchResult  `json:"results"`
+	TimeTaken    float64         `json:"time_taken"`
+	TotalResults int             `json:"total_results"`
+	Offset       int             `json:"offset"`
+	Limit        int             `json:"limit"`
+	Rank         string          `json:"rank"`
+	Reranked     bool            `json:"reranked,omitempty"`
+	Facets       []Facet         `json:"facets,omitempty"`
+	Clusters     []ResultCluster `json:"clusters,omitempty"`
+	NextCursor   string          `json:"next_cursor,omitempty"`
+	PrevCursor   string          `json:"prev_cursor,omitempty"`
+	// Posts and Feeds hold the sections of a type=all search
+	Posts *SearchResponse `json:"posts,omitempty"`
+	Feeds *SearchResponse `json:"feeds,omitempty"`
+}
+
+// QueryErrorResponse is the JSON body returned when a query can't be parsed,
+// or, with Unavailable set, when an upstream service failed
+type QueryErrorResponse struct {
+	Error       string      `json:"error"`
+	Errors      QueryErrors `json:"errors"`
+	Unavailable bool        `json:"unavailable,omitempty"`
+	RetryAfter  int         `json:"retry_after,omitempty"`
 }
 
 // RSSCacheItem represents a cached RSS feed
@@ -66,9 +114,14 @@ type CustomRSSConfig struct {
 
 // App represents the main application with all its dependencies
 type App struct {
-	templates   *template.Template
-	pineconeAPI *PineconeClient
-	voyageAPI   *VoyageClient
-	rssCache    map[string]RSSCacheItem
-	rssMutex    sync.RWMutex
+	templates    *template.Template
+	pineconeAPI  *PineconeClient
+	embedder     Embedder
+	embedCache   *EmbeddingCache
+	usage        *UsageLedger
+	lexicalIndex *lexicalIndex
+	reranker     Reranker
+	timeouts     StageTimeouts
+	rssCache     map[string]RSSCacheItem
+	rssMutex     sync.RWMutex
 }
\ No newline at end of file
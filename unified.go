@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// namespaceAll searches posts and feeds together
+const namespaceAll = "all"
+
+// FeedLink identifies the feed entry a post belongs to
+type FeedLink struct {
+	Title  string `json:"title"`
+	URL    string `json:"url"`
+	RSSURL string `json:"rss_url"`
+}
+
+// performUnifiedSearch searches posts and feeds concurrently and returns each
+// as its own section. Posts are linked to the feed in the feeds section that
+// shares their base URL.
+func (app *App) performUnifiedSearch(ctx context.Context, req *SearchRequest) (SearchResponse, error) {
+	start := time.Now()
+	if req.Cursor != "" {
+		return SearchResponse{}, QueryErrors{{Field: "cursor", Message: "cursors page a single section; send them with namespace posts or feeds"}}
+	}
+	postsReq, feedsReq := req.splitNamespaces()
+
+	var posts, feeds SearchResponse
+	var postsErr, feedsErr error
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		posts, postsErr = app.performSearch(ctx, postsReq)
+	}()
+	go func() {
+		defer wg.Done()
+		feeds, feedsErr = app.performSearch(ctx, feedsReq)
+	}()
+	wg.Wait()
+
+	// Both sections share the query text, so their errors largely overlap
+	if postsErr != nil {
+		return SearchResponse{}, postsErr
+	}
+	if feedsErr != nil {
+		return SearchResponse{}, feedsErr
+	}
+
+	linkPostsToFeeds(posts.Results, feeds.Results)
+	return SearchResponse{
+		Results:      []SearchResult{},
+		TimeTaken:    time.Since(start).Seconds(),
+		TotalResults: posts.TotalResults + feeds.TotalResults,
+		Offset:       req.Offset,
+		Limit:        req.limit(),
+		Rank:         posts.Rank,
+		Posts:        &posts,
+		Feeds:        &feeds,
+	}, nil
+}
+
+// splitNamespaces returns copies of a namespace "all" request for posts and
+// for feeds. Feeds have no content type, date or length, so those typed
+// filters only apply to posts; filters in the query text apply to both.
+func (req *SearchRequest) splitNamespaces() (*SearchRequest, *SearchRequest) {
+	postsReq := *req
+	postsReq.Namespace = "posts"
+	postsReq.IncludePosts = false
+
+	feedsReq := *req
+	feedsReq.Namespace = "feeds"
+	feedsReq.Filters.Content = nil
+	feedsReq.Filters.Since = ""
+	feedsReq.Filters.Until = ""
+	feedsReq.Filters.MinLength = nil
+	feedsReq.paramErrs = nil
+	return &postsReq, &feedsReq
+}
+
+// linkPostsToFeeds sets Feed on each post whose base URL matches a feed
+func linkPostsToFeeds(posts, feeds []SearchResult) {
+	byBaseURL := make(map[string]*SearchResult, len(feeds))
+	for i := range feeds {
+		if key := cleanURL(feeds[i].OriginalDomain); key != "" {
+			byBaseURL[key] = &feeds[i]
+		}
+	}
+	for i := range posts {
+		if feed, ok := byBaseURL[cleanURL(posts[i].OriginalDomain)]; ok {
+			posts[i].Feed = &FeedLink{Title: feed.Title, URL: feed.URL, RSSURL: feed.RSSURL}
+		}
+	}
+}
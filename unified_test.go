@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestSplitNamespaces(t *testing.T) {
+	minLength := 1000
+	req := &SearchRequest{
+		Text:         "rust lang:en",
+		Namespace:    namespaceAll,
+		IncludePosts: true,
+		Limit:        10,
+		Filters: SearchFilters{
+			Content:   []string{"blogs"},
+			Sites:     []string{"a.com"},
+			Langs:     []string{"en"},
+			Since:     "2024-01",
+			Until:     "2024-06",
+			MinLength: &minLength,
+		},
+	}
+	original := *req
+	postsReq, feedsReq := req.splitNamespaces()
+
+	if postsReq.Namespace != "posts" || postsReq.IncludePosts || !reflect.DeepEqual(postsReq.Filters, req.Filters) {
+		t.Errorf("posts request %+v", postsReq)
+	}
+	wantFeedFilters := SearchFilters{Sites: []string{"a.com"}, Langs: []string{"en"}}
+	if feedsReq.Namespace != "feeds" || !feedsReq.IncludePosts || !reflect.DeepEqual(feedsReq.Filters, wantFeedFilters) {
+		t.Errorf("feeds request %+v, want only the filters feeds have", feedsReq)
+	}
+	if feedsReq.Text != req.Text || feedsReq.Limit != req.Limit || postsReq.Text != req.Text {
+		t.Error("the query text and page aren't shared by both sections")
+	}
+	if !reflect.DeepEqual(*req, original) {
+		t.Errorf("splitting changed the request: %+v", req)
+	}
+}
+
+func TestLinkPostsToFeeds(t *testing.T) {
+	feeds := []SearchResult{
+		{URL: "https://www.example.com/", OriginalDomain: "https://www.example.com/", Title: "Example", RSSURL: "https://www.example.com/feed.xml"},
+		{URL: "https://blog.other.org", OriginalDomain: "https://blog.other.org", Title: "Other", RSSURL: "https://blog.other.org/rss"},
+		{URL: "", OriginalDomain: "", Title: "Nameless"},
+	}
+	posts := []SearchResult{
+		{URL: "https://example.com/post", OriginalDomain: "http://example.com"},
+		{URL: "https://blog.other.org/post", OriginalDomain: "https://blog.other.org/"},
+		{URL: "https://other.org/post", OriginalDomain: "https://other.org"},
+		{URL: "no-domain"},
+	}
+	linkPostsToFeeds(posts, feeds)
+
+	want := []*FeedLink{
+		{Title: "Example", URL: "https://www.example.com/", RSSURL: "https://www.example.com/feed.xml"},
+		{Title: "Other", URL: "https://blog.other.org", RSSURL: "https://blog.other.org/rss"},
+		nil,
+		nil,
+	}
+	for i, post := range posts {
+		if !reflect.DeepEqual(post.Feed, want[i]) {
+			t.Errorf("%s linked to %+v, want %+v", post.URL, post.Feed, want[i])
+		}
+	}
+}
+
+// pineconeSections answers posts and feeds queries from one site
+func pineconeSections(w http.ResponseWriter, r *http.Request) {
+	var query PineconeQueryRequest
+	json.NewDecoder(r.Body).Decode(&query)
+	var match PineconeMatch
+	if query.Namespace == corpora[corpusFeeds].Namespace {
+		match = PineconeMatch{ID: "https://www.example.com/feed.xml", Score: 0.8, Metadata: map[string]interface{}{
+			"baseurl": "https://www.example.com/", "title": "Example Blog",
+		}}
+	} else {
+		match = PineconeMatch{ID: "https://example.com/rust", Score: 0.9, Metadata: map[string]interface{}{
+			"base_url": "https://example.com", "title": "Rust at Example",
+		}}
+	}
+	json.NewEncoder(w).Encode(PineconeQueryResponse{Matches: []PineconeMatch{match}})
+}
+
+func TestPerformUnifiedSearch(t *testing.T) {
+	app := searchTestApp(t, pineconeSections)
+	response, err := app.performSearch(context.Background(), &SearchRequest{Text: "rust", Namespace: namespaceAll})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Posts == nil || response.Feeds == nil || len(response.Results) != 0 {
+		t.Fatalf("response %+v, want posts and feeds sections", response)
+	}
+	if response.TotalResults != 2 || len(response.Posts.Results) != 1 || len(response.Feeds.Results) != 1 {
+		t.Errorf("total %d, posts %v, feeds %v", response.TotalResults, resultURLs(response.Posts.Results), resultURLs(response.Feeds.Results))
+	}
+	post := response.Posts.Results[0]
+	if post.Feed == nil || post.Feed.Title != "Example Blog" || post.Feed.RSSURL != "https://www.example.com/feed.xml" {
+		t.Errorf("post linked to %+v", post.Feed)
+	}
+
+	_, err = app.performSearch(context.Background(), &SearchRequest{Text: "rust", Namespace: namespaceAll, Cursor: "abc"})
+	if fields := queryErrorFields(err); !reflect.DeepEqual(fields, []string{"cursor"}) {
+		t.Errorf("cursor with namespace all: error %v", err)
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+)
+
+// upstreamRetryAfter is the Retry-After, in seconds, sent when a search
+// can't be answered because Voyage or Pinecone failed
+const upstreamRetryAfter = 30
+
+// UpstreamError reports that a search couldn't be answered because a
+// service it depends on failed, as opposed to finding nothing
+type UpstreamError struct {
+	Service string
+	Err     error
+}
+
+func (e *UpstreamError) Error() string {
+	return fmt.Sprintf("%s unavailable: %v", e.Service, e.Err)
+}
+
+func (e *UpstreamError) Unwrap() error {
+	return e.Err
+}
+
+// APIError is a response from an upstream API with a status other than 200
+type APIError struct {
+	API        string // e.g. "pinecone API"
+	StatusCode int
+	Body       string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%s error %d: %s", e.API, e.StatusCode, e.Body)
+}
+
+// newAPIError reads the body of a failed response from api
+func newAPIError(api string, resp *http.Response) error {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	return &APIError{API: api, StatusCode: resp.StatusCode, Body: string(body)}
+}
+
+// isOutage reports whether err means a service is unavailable rather than
+// that it rejected the request: it couldn't be reached, timed out, was rate
+// limited or failed with a 5xx. Running out of the embedding budget counts
+// too, since only cached embeddings can be served until it resets.
+func isOutage(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, errEmbeddingBudget) {
+		return true
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// upstreamFailure marks err as a failure of service if it is an outage.
+// Other errors, such as a request the service rejected with a 4xx or a
+// vector that doesn't exist, are returned as they are, and errors already
+// attributed to a service keep their service.
+func upstreamFailure(service string, err error) error {
+	var upstreamErr *UpstreamError
+	if err == nil || errors.As(err, &upstreamErr) || !isOutage(err) {
+		return err
+	}
+	return &UpstreamError{Service: service, Err: err}
+}
+
+// isUpstreamFailure reports whether err means an upstream service failed
+func isUpstreamFailure(err error) bool {
+	var upstreamErr *UpstreamError
+	return errors.As(err, &upstreamErr)
+}
+
+// writeSearchError writes a 503 with Retry-After when an upstream service
+// failed, a 400 listing the problems with the query, and a 500 otherwise
+func writeSearchError(w http.ResponseWriter, err error) {
+	var queryErrs QueryErrors
+	if errors.As(err, &queryErrs) {
+		writeQueryError(w, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if !isUpstreamFailure(err) {
+		w.WriteHeader(http.StatusInternalServerError)
+		json.NewEncoder(w).Encode(QueryErrorResponse{Error: "search failed: " + err.Error()})
+		return
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(upstreamRetryAfter))
+	w.WriteHeader(http.StatusServiceUnavailable)
+	json.NewEncoder(w).Encode(QueryErrorResponse{
+		Error:       "search is temporarily unavailable: " + err.Error(),
+		Unavailable: true,
+		RetryAfter:  upstreamRetryAfter,
+	})
+}
+
+// writeUnavailable writes a plain 503 with Retry-After, for responses that
+// aren't JSON
+func writeUnavailable(w http.ResponseWriter, err error) {
+	w.Header().Set("Retry-After", strconv.Itoa(upstreamRetryAfter))
+	http.Error(w, "Search is temporarily unavailable, please retry later: "+err.Error(), http.StatusServiceUnavailable)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// searchTestApp returns an App whose corpora query a Pinecone stand-in
+// served by handler, embedding with fakeEmbedder
+func searchTestApp(t *testing.T, handler http.HandlerFunc) *App {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	useRetryPolicy(t, RetryPolicy{MaxAttempts: 1})
+
+	client := NewPineconeClient("key", server.URL, "test")
+	registry := defaultCorpora()
+	for _, corpus := range registry {
+		corpus.client = client
+	}
+	saved := corpora
+	corpora = registry
+	t.Cleanup(func() { corpora = saved })
+
+	return &App{
+		pineconeAPI:  client,
+		embedder:     &fakeEmbedder{},
+		lexicalIndex: newLexicalIndex(),
+		reranker:     noopReranker{},
+		timeouts:     defaultStageTimeouts,
+		rssCache:     make(map[string]RSSCacheItem),
+	}
+}
+
+// pineconeStatus answers every Pinecone request with status
+func pineconeStatus(status int) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if status != http.StatusOK {
+			http.Error(w, "pinecone says no", status)
+			return
+		}
+		fmt.Fprint(w, `{"matches": []}`)
+	}
+}
+
+func TestIsOutage(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&APIError{API: "pinecone API", StatusCode: 400}, false},
+		{&APIError{API: "pinecone API", StatusCode: 404}, false},
+		{fmt.Errorf("query failed: %w", &APIError{API: "pinecone API", StatusCode: 429}), true},
+		{&APIError{API: "voyage API", StatusCode: 503}, true},
+		{fmt.Errorf("embedding: %w", context.DeadlineExceeded), true},
+		{errEmbeddingBudget, true},
+		{fmt.Errorf("%w for ID: x", errVectorNotFound), false},
+		{errors.New("failed to decode response"), false},
+	}
+	for _, tt := range tests {
+		if got := isOutage(tt.err); got != tt.want {
+			t.Errorf("isOutage(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+		if got := isUpstreamFailure(upstreamFailure("pinecone", tt.err)); got != tt.want {
+			t.Errorf("upstreamFailure(%v) marked %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestSearchUpstreamStatus(t *testing.T) {
+	tests := []struct {
+		status   int
+		response int
+	}{
+		{http.StatusOK, http.StatusOK},
+		{http.StatusBadRequest, http.StatusInternalServerError},
+		{http.StatusUnauthorized, http.StatusInternalServerError},
+		{http.StatusTooManyRequests, http.StatusServiceUnavailable},
+		{http.StatusServiceUnavailable, http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		app := searchTestApp(t, pineconeStatus(tt.status))
+		recorder := httptest.NewRecorder()
+		app.handleAPISearch(recorder, httptest.NewRequest("GET", "/api/search?qry=rust", nil))
+		if recorder.Code != tt.response {
+			t.Errorf("pinecone %d: search answered %d, want %d: %s", tt.status, recorder.Code, tt.response, recorder.Body)
+		}
+	}
+}
+
+func TestSearchUnreachable(t *testing.T) {
+	app := searchTestApp(t, pineconeStatus(http.StatusOK))
+	for _, corpus := range corpora {
+		corpus.client.host = "http://127.0.0.1:1"
+	}
+	_, err := app.performSearch(context.Background(), &SearchRequest{Text: "rust"})
+	if !isUpstreamFailure(err) {
+		t.Errorf("unreachable Pinecone: error %v, want an upstream failure", err)
+	}
+}
+
+// A stale feed stands in while Pinecone is down, but not when it rejects
+// the query, which retrying won't fix
+func TestRSSStaleOnlyForOutages(t *testing.T) {
+	tests := []struct {
+		status int
+		stale  bool
+		code   int
+	}{
+		{http.StatusServiceUnavailable, true, http.StatusOK},
+		{http.StatusBadRequest, false, http.StatusInternalServerError},
+	}
+	for _, tt := range tests {
+		app := searchTestApp(t, pineconeStatus(tt.status))
+		app.rssCache["qry=rust"] = RSSCacheItem{content: "<rss>cached</rss>", timestamp: time.Now().Add(-time.Hour)}
+
+		recorder := httptest.NewRecorder()
+		app.handleRSSFeed(recorder, httptest.NewRequest("GET", "/rss?qry=rust", nil))
+		served := strings.Contains(recorder.Body.String(), "cached")
+		if recorder.Code != tt.code || served != tt.stale {
+			t.Errorf("pinecone %d: /rss answered %d, stale copy served %v", tt.status, recorder.Code, served)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Request paths that embedding usage is recorded under
+const (
+	usageSearch   = "search"
+	usageTrend    = "trend"
+	usageRSS      = "rss"
+	usageExport   = "export"
+	usageWorkflow = "workflow"
+	usageStartup  = "startup"
+	usageOther    = "other"
+)
+
+// usageHistoryDays is the number of days of usage kept for the report
+const usageHistoryDays = 30
+
+// errEmbeddingBudget is returned for cache misses once the daily budget is
+// spent
+var errEmbeddingBudget = errors.New("daily embedding budget exhausted, serving cached embeddings only")
+
+type usagePathKey struct{}
+
+// withUsagePath labels the embedding usage of ctx with a request path
+func withUsagePath(ctx context.Context, path string) context.Context {
+	return context.WithValue(ctx, usagePathKey{}, path)
+}
+
+// usagePathOf returns the request path that ctx is labelled with
+func usagePathOf(ctx context.Context) string {
+	if path, ok := ctx.Value(usagePathKey{}).(string); ok {
+		return path
+	}
+	return usageOther
+}
+
+// usageHandler labels the embedding usage of a route's requests with path
+func usageHandler(path string, handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		handler(w, r.WithContext(withUsagePath(r.Context(), path)))
+	}
+}
+
+type usageSinkKey struct{}
+
+// usageSink collects the tokens embedding APIs report during one call
+type usageSink struct {
+	tokens int64
+}
+
+// withUsageSink returns a context that embedding clients report tokens to
+func withUsageSink(ctx context.Context) (context.Context, *usageSink) {
+	sink := &usageSink{}
+	return context.WithValue(ctx, usageSinkKey{}, sink), sink
+}
+
+// reportEmbeddingTokens passes the tokens an embedding API billed for a
+// request to the sink of ctx, if it has one
+func reportEmbeddingTokens(ctx context.Context, tokens int) {
+	if sink, ok := ctx.Value(usageSinkKey{}).(*usageSink); ok {
+		atomic.AddInt64(&sink.tokens, int64(tokens))
+	}
+}
+
+// UsageLedger totals embedding tokens per UTC day and request path. With a
+// daily budget, it reports when the day's tokens have run out.
+type UsageLedger struct {
+	budget int64
+	now    func() time.Time
+
+	mu        sync.Mutex
+	days      map[string]map[string]*PathUsage
+	exhausted string // the day the budget ran out, to log it once
+}
+
+// PathUsage is the tokens billed for the texts embedded for one path
+type PathUsage struct {
+	Tokens int64 `json:"tokens"`
+	Texts  int64 `json:"texts"`
+}
+
+// DayUsage is one day of embedding usage
+type DayUsage struct {
+	Date   string               `json:"date"`
+	Tokens int64                `json:"tokens"`
+	Texts  int64                `json:"texts"`
+	Paths  map[string]PathUsage `json:"paths"`
+}
+
+// UsageReport is the embedding usage of recent days, newest first
+type UsageReport struct {
+	Date        string     `json:"date"`
+	DailyBudget int64      `json:"daily_budget,omitempty"`
+	Remaining   int64      `json:"remaining,omitempty"`
+	CachedOnly  bool       `json:"cached_only"`
+	Days        []DayUsage `json:"days"`
+}
+
+// NewUsageLedger records usage against a daily budget of tokens, or none
+// when budget is 0
+func NewUsageLedger(budget int64) *UsageLedger {
+	return &UsageLedger{budget: budget, now: time.Now, days: make(map[string]map[string]*PathUsage)}
+}
+
+// usageDay returns the UTC date usage is recorded under
+func usageDay(t time.Time) string {
+	return t.UTC().Format("2006-01-02")
+}
+
+// record adds the tokens billed for embedding texts for path
+func (ul *UsageLedger) record(path string, tokens int64, texts int64) {
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+	today := usageDay(ul.now())
+	paths := ul.days[today]
+	if paths == nil {
+		paths = make(map[string]*PathUsage)
+		ul.days[today] = paths
+		ul.prune(today)
+	}
+	if paths[path] == nil {
+		paths[path] = &PathUsage{}
+	}
+	paths[path].Tokens += tokens
+	paths[path].Texts += texts
+}
+
+// prune drops days that have left the history. The caller holds ul.mu.
+func (ul *UsageLedger) prune(today string) {
+	t, _ := time.Parse("2006-01-02", today)
+	oldest := usageDay(t.AddDate(0, 0, -(usageHistoryDays - 1)))
+	for day := range ul.days {
+		if day < oldest {
+			delete(ul.days, day)
+		}
+	}
+}
+
+// spent returns the tokens recorded on day. The caller holds ul.mu.
+func (ul *UsageLedger) spent(day string) int64 {
+	var tokens int64
+	for _, usage := range ul.days[day] {
+		tokens += usage.Tokens
+	}
+	return tokens
+}
+
+// exhaustedToday reports whether today's budget is spent, logging the first
+// time it is each day
+func (ul *UsageLedger) exhaustedToday() bool {
+	if ul.budget <= 0 {
+		return false
+	}
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+	today := usageDay(ul.now())
+	if ul.spent(today) < ul.budget {
+		return false
+	}
+	if ul.exhausted != today {
+		ul.exhausted = today
+		log.Printf("Daily embedding budget of %d tokens exhausted, serving cached embeddings only until midnight UTC", ul.budget)
+	}
+	return true
+}
+
+// Report returns the usage of recent days, newest first
+func (ul *UsageLedger) Report() UsageReport {
+	ul.mu.Lock()
+	defer ul.mu.Unlock()
+	today := usageDay(ul.now())
+	report := UsageReport{Date: today, DailyBudget: ul.budget, Days: []DayUsage{}}
+	if ul.budget > 0 {
+		spent := ul.spent(today)
+		report.CachedOnly = spent >= ul.budget
+		if !report.CachedOnly {
+			report.Remaining = ul.budget - spent
+		}
+	}
+	for day, paths := range ul.days {
+		usage := DayUsage{Date: day, Paths: make(map[string]PathUsage, len(paths))}
+		for path, pathUsage := range paths {
+			usage.Paths[path] = *pathUsage
+			usage.Tokens += pathUsage.Tokens
+			usage.Texts += pathUsage.Texts
+		}
+		report.Days = append(report.Days, usage)
+	}
+	sort.Slice(report.Days, func(i, j int) bool {
+		return report.Days[i].Date > report.Days[j].Date
+	})
+	return report
+}
+
+// recordBatch splits the tokens billed for a batch across its texts by
+// length, and records each text for the path of the caller that asked first
+func (ul *UsageLedger) recordBatch(calls []*embeddingCall, tokens int64) {
+	var length int64
+	for _, call := range calls {
+		length += int64(len(call.text))
+	}
+	remaining := tokens
+	for i, call := range calls {
+		share := remaining
+		if i < len(calls)-1 && length > 0 {
+			share = tokens * int64(len(call.text)) / length
+		}
+		remaining -= share
+		ul.record(call.path, share, 1)
+	}
+}
+
+// budgetedEmbedder refuses to embed once the daily budget is spent. In front
+// of it, the embedding cache keeps answering the texts it already has.
+type budgetedEmbedder struct {
+	embedder Embedder
+	usage    *UsageLedger
+}
+
+func (be *budgetedEmbedder) Model() string {
+	return be.embedder.Model()
+}
+
+func (be *budgetedEmbedder) GetEmbeddingWithType(ctx context.Context, text string, inputType string) ([]float64, error) {
+	if be.usage.exhaustedToday() {
+		return nil, errEmbeddingBudget
+	}
+	return be.embedder.GetEmbeddingWithType(ctx, text, inputType)
+}
+
+func (be *budgetedEmbedder) GetEmbeddings(ctx context.Context, texts []string, inputType string) ([][]float64, error) {
+	if be.usage.exhaustedToday() {
+		return nil, errEmbeddingBudget
+	}
+	return be.embedder.GetEmbeddings(ctx, texts, inputType)
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+// ledgerAt returns a ledger whose clock reads *now
+func ledgerAt(budget int64, now *time.Time) *UsageLedger {
+	ledger := NewUsageLedger(budget)
+	ledger.now = func() time.Time { return *now }
+	return ledger
+}
+
+func TestUsageRollsOverAtUTCMidnight(t *testing.T) {
+	now := time.Date(2024, 5, 1, 23, 59, 0, 0, time.UTC)
+	ledger := ledgerAt(100, &now)
+
+	ledger.record(usageSearch, 60, 3)
+	// 01:30 in UTC+2 is still 1 May in UTC
+	now = time.Date(2024, 5, 2, 1, 30, 0, 0, time.FixedZone("UTC+2", 2*60*60))
+	ledger.record(usageRSS, 40, 2)
+	if !ledger.exhaustedToday() {
+		t.Fatal("100 of 100 tokens spent, budget not exhausted")
+	}
+	report := ledger.Report()
+	if report.Date != "2024-05-01" || !report.CachedOnly || report.Remaining != 0 {
+		t.Errorf("report %+v, want 1 May cached only", report)
+	}
+
+	now = time.Date(2024, 5, 2, 0, 0, 0, 0, time.UTC)
+	if ledger.exhaustedToday() {
+		t.Error("budget still exhausted on the next UTC day")
+	}
+	ledger.record(usageSearch, 10, 1)
+	report = ledger.Report()
+	if report.CachedOnly || report.Remaining != 90 {
+		t.Errorf("cached only %v, remaining %d, want 90 of a fresh budget", report.CachedOnly, report.Remaining)
+	}
+	if len(report.Days) != 2 || report.Days[0].Date != "2024-05-02" || report.Days[1].Date != "2024-05-01" {
+		t.Fatalf("days %+v, want 2 May then 1 May", report.Days)
+	}
+	yesterday := report.Days[1]
+	if yesterday.Tokens != 100 || yesterday.Texts != 5 || yesterday.Paths[usageRSS].Tokens != 40 {
+		t.Errorf("1 May usage %+v", yesterday)
+	}
+}
+
+func TestUsageWithoutBudget(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ledger := ledgerAt(0, &now)
+	ledger.record(usageSearch, 1<<40, 1)
+	if ledger.exhaustedToday() {
+		t.Error("a ledger without a budget ran out")
+	}
+	if report := ledger.Report(); report.CachedOnly || report.DailyBudget != 0 {
+		t.Errorf("report %+v", report)
+	}
+}
+
+func TestUsagePrunesHistory(t *testing.T) {
+	first := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	now := first
+	ledger := ledgerAt(0, &now)
+	ledger.record(usageSearch, 1, 1)
+
+	now = first.AddDate(0, 0, usageHistoryDays-1)
+	ledger.record(usageSearch, 1, 1)
+	if days := ledger.Report().Days; len(days) != 2 {
+		t.Fatalf("%d days, want the first kept for %d days", len(days), usageHistoryDays)
+	}
+
+	now = first.AddDate(0, 0, usageHistoryDays)
+	ledger.record(usageSearch, 1, 1)
+	days := ledger.Report().Days
+	if len(days) != 2 || days[1].Date != "2024-05-30" {
+		t.Errorf("days %+v, want 1 May pruned", days)
+	}
+}
+
+func TestRecordBatchSplitsTokens(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ledger := ledgerAt(0, &now)
+	calls := []*embeddingCall{
+		{text: "aa", path: usageSearch},
+		{text: "aaaaaa", path: usageRSS},
+		{text: "aa", path: usageSearch},
+	}
+	// 7 tokens over 10 characters: 1 and 4 by length, and the last call
+	// takes the remainder so that none are lost to rounding
+	ledger.recordBatch(calls, 7)
+
+	paths := ledger.Report().Days[0].Paths
+	if got := paths[usageSearch]; got.Tokens != 3 || got.Texts != 2 {
+		t.Errorf("search usage %+v, want 3 tokens for 2 texts", got)
+	}
+	if got := paths[usageRSS]; got.Tokens != 4 || got.Texts != 1 {
+		t.Errorf("rss usage %+v, want 4 tokens for 1 text", got)
+	}
+}
+
+func TestBudgetedEmbedderServesCacheOnly(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	ledger := ledgerAt(10, &now)
+	fake := &fakeEmbedder{}
+	cache, err := NewEmbeddingCache(&budgetedEmbedder{embedder: fake, usage: ledger}, 10, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	if _, err := cache.GetEmbeddingWithType(ctx, "rust", "query"); err != nil {
+		t.Fatalf("within budget: %v", err)
+	}
+	ledger.record(usageSearch, 10, 1)
+
+	if embedding, err := cache.GetEmbeddingWithType(ctx, "rust", "query"); err != nil || embedding[0] != 4 {
+		t.Errorf("cached text over budget: embedding %v, error %v", embedding, err)
+	}
+	if _, err := cache.GetEmbeddingWithType(ctx, "golang", "query"); !errors.Is(err, errEmbeddingBudget) {
+		t.Errorf("uncached text over budget: error %v, want errEmbeddingBudget", err)
+	}
+	if _, err := cache.GetEmbeddings(ctx, []string{"rust", "golang"}, "query"); !errors.Is(err, errEmbeddingBudget) {
+		t.Errorf("batch with a miss over budget: error %v, want errEmbeddingBudget", err)
+	}
+	if fake.requestCount() != 1 {
+		t.Errorf("%d embedding requests, want only the one within budget", fake.requestCount())
+	}
+}
+
+// A search that needs a new embedding once the budget is spent is an outage
+func TestSearchOverBudget(t *testing.T) {
+	app := searchTestApp(t, pineconeStatus(http.StatusOK))
+	ledger := NewUsageLedger(1)
+	ledger.record(usageSearch, 1, 1)
+	app.embedder = &budgetedEmbedder{embedder: &fakeEmbedder{}, usage: ledger}
+
+	recorder := httptest.NewRecorder()
+	app.handleAPISearch(recorder, httptest.NewRequest("GET", "/api/search?qry=rust", nil))
+	if recorder.Code != http.StatusServiceUnavailable {
+		t.Errorf("search over budget answered %d, want 503: %s", recorder.Code, recorder.Body)
+	}
+}
@@ -2,8 +2,8 @@ package main
 
 import (
 	"encoding/base64"
-	"sort"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -33,6 +33,28 @@ func getMetadataString(metadata map[string]interface{}, key string) string {
 	return ""
 }
 
+// getMetadataInt safely extracts a numeric value from metadata map
+func getMetadataInt(metadata map[string]interface{}, key string) int {
+	switch val := metadata[key].(type) {
+	case float64:
+		return int(val)
+	case int:
+		return val
+	}
+	return 0
+}
+
+// getMetadataFloat safely extracts a floating point value from metadata map
+func getMetadataFloat(metadata map[string]interface{}, key string) float64 {
+	switch val := metadata[key].(type) {
+	case float64:
+		return val
+	case int:
+		return float64(val)
+	}
+	return 0
+}
+
 // getMetadataKeys returns all keys from a metadata map
 func getMetadataKeys(metadata map[string]interface{}) []string {
 	keys := make([]string, 0, len(metadata))
@@ -112,9 +134,9 @@ func parseDate(dateStr string) time.Time {
 	return time.Time{} // Return zero time if parsing fails
 }
 
-// parseTimeFromMetadata extracts and parses date from metadata
-func parseTimeFromMetadata(metadata map[string]interface{}) time.Time {
-	dateStr := getMetadataString(metadata, "dt_published")
+// parseTimeFromMetadata extracts and parses the date in a metadata field
+func parseTimeFromMetadata(metadata map[string]interface{}, field string) time.Time {
+	dateStr := getMetadataString(metadata, field)
 	if dateStr == "" {
 		return time.Time{} // Return zero time if no date
 	}
@@ -157,15 +179,6 @@ func base64DecodeString(encoded string) (string, error) {
 	return string(decoded), nil
 }
 
-// sortResultsByTime sorts search results by publication date (most recent first)
-func sortResultsByTime(results []SearchResult) {
-	sort.Slice(results, func(i, j int) bool {
-		dateI := parseDate(results[i].Date)
-		dateJ := parseDate(results[j].Date)
-		return dateI.After(dateJ) // Most recent first
-	})
-}
-
 // deduplicateByTitle removes duplicate search results based on title
 func deduplicateByTitle(results []SearchResult) []SearchResult {
 	seen := make(map[string]bool)
@@ -182,4 +195,32 @@ func deduplicateByTitle(results []SearchResult) []SearchResult {
 	}
 
 	return deduped
+}
+
+// forEachConcurrently calls fn for every index below n, running at most
+// workers calls at once, and returns once they have all finished. Each index
+// is handled by exactly one call, so fn may write to its own slice element.
+func forEachConcurrently(n, workers int, fn func(i int)) {
+	if workers > n {
+		workers = n
+	}
+	if workers < 1 {
+		workers = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < n; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
 }
\ No newline at end of file
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestForEachConcurrently(t *testing.T) {
+	const n, workers = 50, 4
+	var running, peak int32
+	seen := make([]int32, n)
+	forEachConcurrently(n, workers, func(i int) {
+		now := atomic.AddInt32(&running, 1)
+		for {
+			old := atomic.LoadInt32(&peak)
+			if now <= old || atomic.CompareAndSwapInt32(&peak, old, now) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		atomic.AddInt32(&seen[i], 1)
+		atomic.AddInt32(&running, -1)
+	})
+
+	for i, count := range seen {
+		if count != 1 {
+			t.Errorf("index %d handled %d times", i, count)
+		}
+	}
+	if peak > workers {
+		t.Errorf("%d calls ran at once, want at most %d", peak, workers)
+	}
+
+	// No work and no workers must not block
+	forEachConcurrently(0, workers, func(int) { t.Error("called with n = 0") })
+	calls := 0
+	forEachConcurrently(3, 0, func(int) { calls++ })
+	if calls != 3 {
+		t.Errorf("%d calls with 0 workers, want 3", calls)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import "math"
+
+// dotProduct returns the dot product of two vectors of equal length
+func dotProduct(a, b []float64) float64 {
+	n := len(a)
+	if len(b) < n {
+		n = len(b)
+	}
+	sum := 0.0
+	for i := 0; i < n; i++ {
+		sum += a[i] * b[i]
+	}
+	return sum
+}
+
+// vectorNorm returns the Euclidean length of a vector
+func vectorNorm(v []float64) float64 {
+	return math.Sqrt(dotProduct(v, v))
+}
+
+// normalizeVector returns a unit-length copy of v
+func normalizeVector(v []float64) []float64 {
+	out := make([]float64, len(v))
+	norm := vectorNorm(v)
+	if norm == 0 {
+		return out
+	}
+	for i, x := range v {
+		out[i] = x / norm
+	}
+	return out
+}
+
+// cosineSimilarity returns the cosine of the angle between two vectors
+func cosineSimilarity(a, b []float64) float64 {
+	na, nb := vectorNorm(a), vectorNorm(b)
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dotProduct(a, b) / (na * nb)
+}
@@ -2,16 +2,27 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"net/http"
-	"time"
+	"strings"
 )
 
+// Voyage client defaults. The model is the one the indexes were embedded
+// with.
+const (
+	defaultVoyageURL   = "https://api.voyageai.com/v1"
+	defaultVoyageModel = "voyage-3-large"
+)
+
+// VoyageClient embeds text with Voyage's /embeddings API. The base URL is
+// configurable so a proxy can stand in for Voyage.
 type VoyageClient struct {
-	apiKey string
-	client *http.Client
+	apiKey   string
+	endpoint string
+	model    string
+	client   *http.Client
 }
 
 type VoyageEmbeddingRequest struct {
@@ -31,20 +42,25 @@ type VoyageEmbeddingResponse struct {
 	} `json:"usage"`
 }
 
-func NewVoyageClient(apiKey string) *VoyageClient {
+func NewVoyageClient(apiKey, baseURL, model string) *VoyageClient {
 	return &VoyageClient{
-		apiKey: apiKey,
-		client: &http.Client{
-			Timeout: 30 * time.Second,
-		},
+		apiKey:   apiKey,
+		endpoint: strings.TrimSuffix(baseURL, "/") + "/embeddings",
+		model:    model,
+		// Deadlines come from the context of each call
+		client: newRetryingClient("voyage"),
 	}
 }
 
-func (vc *VoyageClient) GetEmbedding(text string) ([]float64, error) {
-	return vc.GetEmbeddingWithType(text, "query")
+func (vc *VoyageClient) Model() string {
+	return vc.model
+}
+
+func (vc *VoyageClient) GetEmbedding(ctx context.Context, text string) ([]float64, error) {
+	return vc.GetEmbeddingWithType(ctx, text, "query")
 }
 
-func (vc *VoyageClient) GetEmbeddingWithType(text string, inputType string) ([]float64, error) {
+func (vc *VoyageClient) GetEmbeddingWithType(ctx context.Context, text string, inputType string) ([]float64, error) {
 	if text == "" {
 		return nil, fmt.Errorf("text cannot be empty")
 	}
@@ -52,7 +68,7 @@ func (vc *VoyageClient) GetEmbeddingWithType(text string, inputType string) ([]f
 	// Build request
 	reqBody := VoyageEmbeddingRequest{
 		Input:     []string{text},
-		Model:     "voyage-3-large",
+		Model:     vc.model,
 		InputType: inputType,
 	}
 
@@ -62,13 +78,14 @@ func (vc *VoyageClient) GetEmbeddingWithType(text string, inputType string) ([]f
 	}
 
 	// Make HTTP request
-	url := "https://api.voyageai.com/v1/embeddings"
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", vc.endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	// Embedding has no side effects, so it is safe to retry
+	markIdempotent(req)
 	req.Header.Set("Authorization", "Bearer "+vc.apiKey)
 
 	resp, err := vc.client.Do(req)
@@ -78,8 +95,7 @@ func (vc *VoyageClient) GetEmbeddingWithType(text string, inputType string) ([]f
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("voyage API error %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError("voyage API", resp)
 	}
 
 	// Parse response
@@ -87,6 +103,7 @@ func (vc *VoyageClient) GetEmbeddingWithType(text string, inputType string) ([]f
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	reportEmbeddingTokens(ctx, response.Usage.TotalTokens)
 
 	if len(response.Data) == 0 {
 		return nil, fmt.Errorf("no embedding returned")
@@ -95,7 +112,7 @@ func (vc *VoyageClient) GetEmbeddingWithType(text string, inputType string) ([]f
 	return response.Data[0].Embedding, nil
 }
 
-func (vc *VoyageClient) GetEmbeddings(texts []string, inputType string) ([][]float64, error) {
+func (vc *VoyageClient) GetEmbeddings(ctx context.Context, texts []string, inputType string) ([][]float64, error) {
 	if len(texts) == 0 {
 		return nil, fmt.Errorf("texts cannot be empty")
 	}
@@ -103,7 +120,7 @@ func (vc *VoyageClient) GetEmbeddings(texts []string, inputType string) ([][]flo
 	// Build request
 	reqBody := VoyageEmbeddingRequest{
 		Input:     texts,
-		Model:     "voyage-3-large",
+		Model:     vc.model,
 		InputType: inputType,
 	}
 
@@ -113,13 +130,14 @@ func (vc *VoyageClient) GetEmbeddings(texts []string, inputType string) ([][]flo
 	}
 
 	// Make HTTP request
-	url := "https://api.voyageai.com/v1/embeddings"
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonData))
+	req, err := http.NewRequestWithContext(ctx, "POST", vc.endpoint, bytes.NewBuffer(jsonData))
 	if err != nil {
 		return nil, fmt.Errorf("failed to create request: %w", err)
 	}
 
 	req.Header.Set("Content-Type", "application/json")
+	// Embedding has no side effects, so it is safe to retry
+	markIdempotent(req)
 	req.Header.Set("Authorization", "Bearer "+vc.apiKey)
 
 	resp, err := vc.client.Do(req)
@@ -129,8 +147,7 @@ func (vc *VoyageClient) GetEmbeddings(texts []string, inputType string) ([][]flo
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
-		body, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("voyage API error %d: %s", resp.StatusCode, string(body))
+		return nil, newAPIError("voyage API", resp)
 	}
 
 	// Parse response
@@ -138,6 +155,7 @@ func (vc *VoyageClient) GetEmbeddings(texts []string, inputType string) ([][]flo
 	if err := json.NewDecoder(resp.Body).Decode(&response); err != nil {
 		return nil, fmt.Errorf("failed to decode response: %w", err)
 	}
+	reportEmbeddingTokens(ctx, response.Usage.TotalTokens)
 
 	if len(response.Data) != len(texts) {
 		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(response.Data))